@@ -5,10 +5,25 @@ import (
 	"fmt"
 )
 
+// Maximum payload length of a datagram, as the single length byte also covers the 4 identifier bytes
+const MaxDataLength = 0xff - 4
+
+// Maximum payload length of a LongWrite or LongResponse datagram, which have two length bytes
+const MaxLongDataLength = 0xffff - 4
+
+// Returns the maximum payload length for datagrams with the given command
+func maxDataLength(cmd Command) int {
+	if cmd == LongWrite || cmd == LongResponse {
+		return MaxLongDataLength
+	}
+	return MaxDataLength
+}
+
 // Builds RCT datagrams into an internal buffer, with escaping and CRC correction
 type DatagramBuilder struct {
 	buffer bytes.Buffer
 	crc    *CRC
+	err    error // error of the last build, if any
 }
 
 // Returns a new DatagramBuilder
@@ -18,19 +33,33 @@ func NewDatagramBuilder() (b *DatagramBuilder) {
 	}
 }
 
+// Returns a new DatagramBuilder computing checksums with the given CRC polynomial and initial value
+func newDatagramBuilderCRC(poly, init uint16) (b *DatagramBuilder) {
+	return &DatagramBuilder{
+		crc: NewCRCWith(poly, init),
+	}
+}
+
 // Resets the internal buffer and CRC
 func (rdb *DatagramBuilder) Reset() {
 	rdb.buffer.Reset()
 	rdb.crc.Reset()
+	rdb.err = nil
+}
+
+// Adds a byte to the internal buffer, handling escaping and CRC calculation. Never returns an error.
+func (rdb *DatagramBuilder) WriteByte(b byte) error {
+	rdb.writeEscaped(b)
+	rdb.crc.Update(b)
+	return nil
 }
 
-// Adds a byte to the internal buffer, handling escaping and CRC calculation
-func (rdb *DatagramBuilder) WriteByte(b byte) {
+// Adds a byte to the internal buffer, handling escaping but without CRC calculation
+func (rdb *DatagramBuilder) writeEscaped(b byte) {
 	if (b == 0x2b) || (b == 0x2d) {
 		rdb.buffer.WriteByte(0x2d) // escape in byte stream (not in CRC stream)
 	}
 	rdb.buffer.WriteByte(b)
-	rdb.crc.Update(b)
 }
 
 // Adds a byte to the internal buffer, without escaping or CRC calculation
@@ -38,29 +67,62 @@ func (rdb *DatagramBuilder) WriteByteUnescapedNoCRC(b byte) {
 	rdb.buffer.WriteByte(b)
 }
 
-// Writes the CRC into the current datastream, handling CRC calcuation padding to an even number of bytes
+// Writes the CRC into the current datastream, handling CRC calcuation padding to an even number of bytes.
+// CRC bytes are escaped like all others, as the parser unescapes the entire frame.
 func (rdb *DatagramBuilder) WriteCRC() {
 	crc := rdb.crc.Get()
-	rdb.buffer.WriteByte(byte(crc >> 8))
-	rdb.buffer.WriteByte(byte(crc & 0xff))
+	rdb.writeEscaped(byte(crc >> 8))
+	rdb.writeEscaped(byte(crc & 0xff))
 }
 
-// Builds a complete datagram into the buffer
+// Builds a complete datagram into the buffer. Payloads exceeding MaxDataLength, or MaxLongDataLength for LongWrite
+// and LongResponse datagrams, are truncated, see Err
 func (rdb *DatagramBuilder) Build(dg *Datagram) {
 	rdb.Reset()
+	data := dg.Data
+	if max := maxDataLength(dg.Cmd); len(data) > max {
+		data = data[:max]
+		rdb.err = fmt.Errorf("payload of %d bytes exceeds maximum of %d, truncated", len(dg.Data), max)
+	}
 	rdb.WriteByteUnescapedNoCRC(0x2b) // Start byte
 	rdb.WriteByte(byte(dg.Cmd))
-	rdb.WriteByte(byte(len(dg.Data) + 4))
+	if dg.Cmd == LongWrite || dg.Cmd == LongResponse {
+		rdb.WriteByte(byte((len(data) + 4) >> 8))
+	}
+	rdb.WriteByte(byte(len(data) + 4))
 	rdb.WriteByte(byte(dg.Id >> 24))
 	rdb.WriteByte(byte((dg.Id >> 16) & 0xff))
 	rdb.WriteByte(byte((dg.Id >> 8) & 0xff))
 	rdb.WriteByte(byte(dg.Id & 0xff))
-	for _, d := range dg.Data {
+	for _, d := range data {
 		rdb.WriteByte(d)
 	}
 	rdb.WriteCRC()
 }
 
+// Builds a complete datagram into the buffer, returning an error instead if the payload exceeds the maximum length
+func (rdb *DatagramBuilder) BuildChecked(dg *Datagram) error {
+	if max := maxDataLength(dg.Cmd); len(dg.Data) > max {
+		rdb.Reset()
+		return fmt.Errorf("payload of %d bytes exceeds maximum of %d", len(dg.Data), max)
+	}
+	rdb.Build(dg)
+	return nil
+}
+
+// Returns the transmission of the given datagram with start byte, escaping and CRC, without a connection.
+// Payloads exceeding the maximum length are truncated like for Build.
+func Encode(dg *Datagram) []byte {
+	builder := NewDatagramBuilder()
+	builder.Build(dg)
+	return builder.Bytes()
+}
+
+// Returns the error of the last build, e.g. if the payload was truncated, or nil
+func (rdb *DatagramBuilder) Err() error {
+	return rdb.err
+}
+
 // Returns the datagram built so far as an array of bytes
 func (r *DatagramBuilder) Bytes() []byte {
 	return r.buffer.Bytes()
@@ -1,6 +1,9 @@
 package rct
 
-import "testing"
+import (
+	"bytes"
+	"testing"
+)
 
 type builderTestCase struct {
 	Dg     Datagram
@@ -10,6 +13,13 @@ type builderTestCase struct {
 var builderTestCases = []builderTestCase{
 	{Datagram{Read, BatteryPowerW, nil}, "[2B 01 04 40 0F 01 5B 58 B4]"},
 	{Datagram{Read, InverterACPowerW, nil}, "[2B 01 04 DB 2D 2D 69 AE 55 AB]"},
+	// odd-length CRC streams, with bytes requiring escaping in identifier and data
+	{Datagram{Write, 0x2B00002D, []byte{0x2D}}, "[2B 02 05 2D 2B 00 00 2D 2D 2D 2D 85 B8]"},
+	{Datagram{Response, BatterySoC, []byte{0x2B, 0x00, 0x2D}}, "[2B 05 07 95 99 30 BF 2D 2B 00 2D 2D 90 87]"},
+	{Datagram{Write, 0x2D2B2D2B, []byte{0x2B}}, "[2B 02 05 2D 2D 2D 2B 2D 2D 2D 2B 2D 2B FA DC]"},
+	// CRC containing bytes requiring escaping
+	{Datagram{Response, BatterySoC, []byte{0x41, 0xA8, 0x00, 0x00}}, "[2B 05 08 95 99 30 BF 41 A8 00 00 5D 2D 2D]"},
+	{Datagram{Response, BatterySoC, []byte{0x42, 0xE3, 0x00, 0x00}}, "[2B 05 08 95 99 30 BF 42 E3 00 00 2D 2B AD]"},
 }
 
 // Test if builder returns expected byte representation
@@ -24,6 +34,30 @@ func TestBuilder(t *testing.T) {
 	}
 }
 
+// Test if Encode and Decode round-trip the builder test cases, and Decode rejects corrupted frames
+func TestEncodeDecodeFrames(t *testing.T) {
+	builder := NewDatagramBuilder()
+	for _, tc := range builderTestCases {
+		raw := Encode(&tc.Dg)
+		builder.Build(&tc.Dg)
+		if !bytes.Equal(raw, builder.Bytes()) {
+			t.Errorf("error got % X, should be %s", raw, tc.Expect)
+		}
+		dg, err := Decode(raw)
+		if err != nil || dg.Cmd != tc.Dg.Cmd || dg.Id != tc.Dg.Id || !bytes.Equal(dg.Data, tc.Dg.Data) {
+			t.Errorf("error got %v %v, should be %s", dg, err, tc.Dg.String())
+		}
+
+		raw[len(raw)-1] ^= 0x01
+		if dg, err := Decode(raw); dg != nil || !IsRecoverable(err) {
+			t.Errorf("error got %v %v for corrupted frame, should be recoverable error", dg, err)
+		}
+	}
+	if dg, err := Decode(nil); dg != nil || !IsRecoverable(err) {
+		t.Errorf("error got %v %v for empty transmission, should be recoverable error", dg, err)
+	}
+}
+
 // Test if roundtrip from builder to parser returns the same datagram
 func TestBuilderParser(t *testing.T) {
 	builder := NewDatagramBuilder()
@@ -48,3 +82,85 @@ func TestBuilderParser(t *testing.T) {
 		}
 	}
 }
+
+// Test if oversized payloads are rejected by BuildChecked, and truncated and flagged by Build
+func TestBuilderOversized(t *testing.T) {
+	builder := NewDatagramBuilder()
+	dg := Datagram{Write, BatterySoCTarget, make([]byte, 300)}
+	if err := builder.BuildChecked(&dg); err == nil {
+		t.Errorf("error 300-byte payload accepted")
+	}
+	if len(builder.Bytes()) != 0 {
+		t.Errorf("error buffer holds %d bytes after rejected build", len(builder.Bytes()))
+	}
+
+	builder.Build(&dg)
+	if builder.Err() == nil {
+		t.Errorf("error truncation not flagged")
+	}
+	if l := builder.Bytes()[2]; l != 0xff {
+		t.Errorf("error got length byte %02X, should be FF", l)
+	}
+
+	dg.Data = dg.Data[:MaxDataLength]
+	if err := builder.BuildChecked(&dg); err != nil || builder.Err() != nil {
+		t.Errorf("error %v for maximum payload", err)
+	}
+}
+
+// Test if strings are NUL-padded to their fixed length, escaped in the frame, and rejected if too long or not ASCII
+func TestBuilderString(t *testing.T) {
+	data, err := EncodeString("RCT+1", 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := []byte{'R', 'C', 'T', '+', '1', 0, 0, 0}; !bytes.Equal(data, expect) {
+		t.Errorf("error got %v, should be %v", data, expect)
+	}
+
+	builder := NewDatagramBuilder()
+	builder.Build(&Datagram{Write, BatterySoCTarget, data})
+	if !bytes.Contains(builder.Bytes(), []byte{'T', 0x2d, '+', '1'}) {
+		t.Errorf("error got % X, should escape the '+' in the string", builder.Bytes())
+	}
+	parser := NewDatagramParser()
+	parser.length = copy(parser.buffer, builder.Bytes())
+	dg, err := parser.Parse()
+	if err != nil || !bytes.Equal(dg.Data, data) {
+		t.Errorf("error got %v %v, should be %v", dg.Data, err, data)
+	}
+
+	if _, err := EncodeString("too long", 4); err == nil {
+		t.Errorf("error oversized string accepted")
+	}
+	if _, err := EncodeString("Grüße", 16); err == nil {
+		t.Errorf("error non-ASCII string accepted")
+	}
+}
+
+// Test if LongWrite datagrams carry two length bytes and round-trip through the parser
+func TestBuilderLongWrite(t *testing.T) {
+	data := make([]byte, 600)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	builder := NewDatagramBuilder()
+	if err := builder.BuildChecked(&Datagram{LongWrite, BatterySoCTarget, data}); err != nil {
+		t.Fatal(err)
+	}
+	if raw := builder.Bytes(); raw[1] != byte(LongWrite) || raw[2] != 0x02 || raw[3] != 0x5c {
+		t.Errorf("error got header % X, should be 2B 03 02 5C", raw[:4])
+	}
+
+	dg, err := VerifyFrame(builder.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dg.Cmd != LongWrite || dg.Id != BatterySoCTarget || !bytes.Equal(dg.Data, data) {
+		t.Errorf("error got %v %08X with %d bytes", dg.Cmd, uint32(dg.Id), len(dg.Data))
+	}
+
+	if err := builder.BuildChecked(&Datagram{LongWrite, BatterySoCTarget, make([]byte, MaxLongDataLength+1)}); err == nil {
+		t.Errorf("error oversized long payload accepted")
+	}
+}
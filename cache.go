@@ -1,6 +1,7 @@
 package rct
 
 import (
+	"sync"
 	"time"
 )
 
@@ -10,30 +11,65 @@ type cacheEntry struct {
 	ts time.Time
 }
 
-// A datagram cache
+// A datagram cache, safe for concurrent use
 type Cache struct {
+	mu      sync.Mutex
 	entries map[Identifier]cacheEntry
 	timeout time.Duration
+	clock   Clock
 }
 
 // Creates a new datagram cache
 func NewCache(timeout time.Duration) (cache *Cache) {
 	return &Cache{
-		make(map[Identifier]cacheEntry),
-		timeout,
+		entries: make(map[Identifier]cacheEntry),
+		timeout: timeout,
+		clock:   realClock{},
 	}
 }
 
 // Returns cache entry for the given identifier, if still valid under timeout
 func (c *Cache) Get(i Identifier) (dg *Datagram, ok bool) {
+	return c.GetMaxAge(i, c.timeout)
+}
+
+// Returns cache entry for the given identifier, if still valid under timeout and at most the given age
+func (c *Cache) GetMaxAge(i Identifier, maxAge time.Duration) (dg *Datagram, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	entry, ok := c.entries[i]
-	if !ok || c.timeout < time.Since(entry.ts) {
+	age := c.clock.Now().Sub(entry.ts)
+	if !ok || c.timeout < age || maxAge < age {
 		return &Datagram{}, false
 	}
 	return entry.dg, true
 }
 
+// Returns the last cached entry for the given identifier and its timestamp, regardless of the timeout
+func (c *Cache) Last(i Identifier) (dg *Datagram, ts time.Time, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[i]
+	return entry.dg, entry.ts, ok
+}
+
 // Puts given datagram into the cache, for the identifier contained in the datagram
 func (c *Cache) Put(dg *Datagram) {
-	c.entries[dg.Id] = cacheEntry{dg, time.Now()}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[dg.Id] = cacheEntry{dg, c.clock.Now()}
+}
+
+// Removes the cache entry for the given identifier, if any
+func (c *Cache) Delete(i Identifier) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, i)
+}
+
+// Removes all cache entries
+func (c *Cache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[Identifier]cacheEntry)
 }
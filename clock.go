@@ -0,0 +1,24 @@
+package rct
+
+import (
+	"time"
+)
+
+// Source of the current time and of timers, which tests may replace to control time-dependent behavior
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// Clock based on the system time
+type realClock struct{}
+
+// Returns the current system time
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// Returns a channel receiving the current system time after the given duration
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
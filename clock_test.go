@@ -0,0 +1,68 @@
+package rct
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// Clock which only advances when told to, firing timers immediately
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// Returns the current fake time
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advances the fake time by the given duration and returns a channel receiving it right away
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	ch <- c.Advance(d)
+	return ch
+}
+
+// Advances the fake time by the given duration, returning the new time
+func (c *fakeClock) Advance(d time.Duration) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	return c.now
+}
+
+// Test if cache expiry and value age follow the configured clock
+func TestWithClock(t *testing.T) {
+	srv := newMockServer(t, respondWith(EncodeFloat32(0.5)))
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	conn, err := NewConnection(srv.Addr(), time.Minute, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Query(BatterySoC); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(59 * time.Second)
+	if _, err := conn.Query(BatterySoC); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.Requests(); n != 1 {
+		t.Errorf("error got %d requests, should be 1 within cache timeout", n)
+	}
+	if _, age, ok := conn.TryQueryFloat32(BatterySoC); !ok || age != 59*time.Second {
+		t.Errorf("error got age %v %v, should be 59s", age, ok)
+	}
+
+	clock.Advance(2 * time.Second)
+	if _, err := conn.Query(BatterySoC); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.Requests(); n != 2 {
+		t.Errorf("error got %d requests, should be 2 after cache timeout", n)
+	}
+}
@@ -1,9 +1,16 @@
 package rct
 
 import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -11,151 +18,712 @@ var (
 	// DialTimeout is the default cache for connecting to a RCT device
 	DialTimeout = time.Second * 5
 
-	// Map of active connections
-	connectionCache = make(map[string]*Connection)
+	// ReadTimeout is the default timeout for receiving a response from a RCT device
+	ReadTimeout = time.Second * 5
+
+	// WriteTimeout is the default timeout for sending a request to a RCT device
+	WriteTimeout = time.Second * 5
+
+	// WriteAckTimeout is the default timeout for receiving the acknowledgement of a write, see WriteAcked
+	WriteAckTimeout = time.Second * 2
+
+	// PingTimeout is the default timeout for receiving the response to a Ping without a context deadline
+	PingTimeout = time.Second * 1
+
+	// ErrTimeout is returned when the RCT device does not respond in time
+	ErrTimeout = errors.New("timeout")
+
+	// ErrDisconnected is returned when the connection to the RCT device is lost or cannot be established
+	ErrDisconnected = errors.New("disconnected")
+
+	// ErrNoWriteAck is returned when the RCT device does not acknowledge a write in time, which depends on the firmware
+	// and does not necessarily mean the write failed
+	ErrNoWriteAck = errors.New("no write acknowledgement")
+
+	// Map of active connections, guarded by connectionCacheMu
+	connectionCache   = make(map[string]*Connection)
+	connectionCacheMu sync.Mutex
 )
 
 // Connection to a RCT device
 type Connection struct {
+	stats  Stats // first field, to keep the 64-bit counters aligned for atomic access
 	mu     sync.Mutex
 	host   string
 	conn   net.Conn
 	parser *DatagramParser
 	cache  *Cache
+
+	builders sync.Pool // reusable datagram builders for outgoing frames, see getBuilder
+
+	flightMu sync.Mutex             // guards inflight
+	inflight map[Identifier]*flight // queries currently awaiting a response, by identifier
+
+	watchMu  sync.Mutex            // guards watchers
+	watchers map[*watcher]struct{} // active watches, see Watch
+
+	dialTimeout time.Duration                                               // timeout for connecting to the device
+	dialer      func(ctx context.Context, address string) (net.Conn, error) // establishes the transport to the device
+	validator   func(id Identifier, v float32) bool                         // optional plausibility check for float32 values
+	logger      Logger                                                      // optional structured logger
+	logLevel    LogLevel                                                    // verbosity of events passed to the logger
+	onError     func(err error)                                             // optional callback for receive and parse errors
+	onResync    func(discarded []byte)                                      // optional callback for bytes skipped before a valid frame
+	capture     io.Writer                                                   // optional recipient of all received bytes
+	serveStale  bool                                                        // answer timed out queries with the last known value, see WithServeStaleOnTimeout
+	maxStale    time.Duration                                               // answer failed queries with values up to this age, see WithStaleOnError
+	maxPowerW   uint16                                                      // maximum power in W accepted by setters, see WithMaxPowerW
+	timeLoc     *time.Location                                              // location of timestamps returned by QueryTime, or nil for TimeLocation
+
+	dedupWindow    time.Duration // drop received datagrams repeating the previous one within this window, if positive
+	lastReceived   *Datagram     // previous received datagram, for deduplication
+	lastReceivedAt time.Time     // time the previous datagram was received
+
+	minSendInterval time.Duration // minimum delay between outgoing frames, if positive
+	lastSend        time.Time     // time of the last outgoing frame
+
+	idleTimeout  time.Duration // close the transport after this long without activity, if positive
+	idleTimer    *time.Timer   // fires after the idle timeout
+	lastActivity time.Time     // time of last send, receive or connect
+
+	backoffInitial    time.Duration // delay before the second reconnect attempt, doubling for each further one
+	backoffMax        time.Duration // maximum delay between reconnect attempts
+	backoffMaxElapsed time.Duration // retry reconnects for up to this long, or try only once if not positive
+
+	clock Clock // source of time for cache expiry, value age and reconnect backoff
+
+	crcPoly uint16 // CRC polynomial of built and parsed frames
+	crcInit uint16 // CRC initial value of built and parsed frames
+
+	closed    chan struct{} // closed by Close, to abort reconnect retries
+	closeOnce sync.Once
 }
 
-// Creates a new connection to a RCT device at the given address.
-// Must not be called concurrently.
-func NewConnection(host string, cache time.Duration) (*Connection, error) {
-	if conn, ok := connectionCache[host]; ok {
-		if conn.conn != nil { // there might be dead connection in the cache, e.g. when connection was disconnected
+// A query awaiting its response, shared by all concurrent callers for the same identifier
+type flight struct {
+	done      chan struct{}
+	dg        *Datagram
+	fromCache bool
+	err       error
+}
+
+// Creates a new connection to a RCT device at the given address, configured by the given options.
+// Returns the existing connection if one to the same address is still active, ignoring the options.
+func NewConnection(host string, cache time.Duration, opts ...Option) (*Connection, error) {
+	if conn := activeConnection(host); conn != nil {
+		return conn, nil
+	}
+
+	conn := newConnection(host, cache, opts...)
+	if err := conn.connect(); err != nil {
+		return nil, err
+	}
+
+	// another caller may have connected to the same host concurrently, in which case theirs wins. Liveness is
+	// checked without holding connectionCacheMu, as a busy connection holds its lock during reads and reconnects.
+	for {
+		connectionCacheMu.Lock()
+		other, ok := connectionCache[host]
+		if !ok {
+			connectionCache[host] = conn
+			connectionCacheMu.Unlock()
 			return conn, nil
 		}
+		connectionCacheMu.Unlock()
+
+		if other.isActive() {
+			conn.conn.Close()
+			return other, nil
+		}
+		connectionCacheMu.Lock()
+		if connectionCache[host] == other { // replace the dead connection, unless another caller already did
+			connectionCache[host] = conn
+			connectionCacheMu.Unlock()
+			return conn, nil
+		}
+		connectionCacheMu.Unlock()
 	}
+}
 
+// Returns a new, unconnected connection to the given address, configured by the given options
+func newConnection(host string, cache time.Duration, opts ...Option) *Connection {
 	conn := &Connection{
-		host:   host,
-		parser: NewDatagramParser(),
-		cache:  NewCache(cache),
+		host:        host,
+		parser:      NewDatagramParser(),
+		cache:       NewCache(cache),
+		inflight:    make(map[Identifier]*flight),
+		dialTimeout: DialTimeout,
+		logLevel:    LogLevelDebug,
+		clock:       realClock{},
+		crcPoly:     DefaultCRCPoly,
+		crcInit:     DefaultCRCInit,
+		maxPowerW:   MaxPowerW,
+		closed:      make(chan struct{}),
 	}
+	conn.dialer = conn.dialTCP
+	conn.builders.New = func() interface{} { return newDatagramBuilderCRC(conn.crcPoly, conn.crcInit) }
+	for _, opt := range opts {
+		opt(conn)
+	}
+	conn.parser.crcPoly, conn.parser.crcInit = conn.crcPoly, conn.crcInit
+	return conn
+}
 
-	if err := conn.connect(); err != nil {
-		return nil, err
+// Returns the cached connection to the given host, or nil if there is none or it is dead
+func activeConnection(host string) *Connection {
+	connectionCacheMu.Lock()
+	conn, ok := connectionCache[host]
+	connectionCacheMu.Unlock()
+	if ok && conn.isActive() { // checked without connectionCacheMu, see NewConnection
+		return conn
 	}
+	return nil // there might be dead connection in the cache, e.g. when connection was disconnected
+}
 
-	connectionCache[host] = conn
-	return conn, nil
+// Returns whether the connection to the device is established
+func (c *Connection) isActive() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn != nil
 }
 
 // Connects an uninitialized RCT connection to the device at the given address
 func (c *Connection) connect() (err error) {
-	address := net.JoinHostPort(c.host, "8899") // default port for RCT
-	c.conn, err = net.DialTimeout("tcp", address, DialTimeout)
-	return err
+	ctx, cancel := context.WithTimeout(context.Background(), c.dialTimeout)
+	defer cancel()
+	c.conn, err = c.dialer(ctx, c.address())
+	if err != nil {
+		c.conn = nil
+		return fmt.Errorf("%w: %v", ErrDisconnected, err)
+	}
+	c.parser.Reset() // bytes retained from a previous transport are stale
+	c.touch()
+	return nil
 }
 
-// Closes the RCT device connection
-func (c *Connection) Close() {
+// Records activity on the connection, restarting the idle timer. Must be called with the connection locked
+func (c *Connection) touch() {
+	if c.idleTimeout <= 0 {
+		return
+	}
+	c.lastActivity = time.Now()
+	if c.idleTimer == nil {
+		c.idleTimer = time.AfterFunc(c.idleTimeout, c.closeIdle)
+	} else {
+		c.idleTimer.Reset(c.idleTimeout)
+	}
+}
+
+// Closes the transport once idle for the idle timeout. It is re-established transparently on next use
+func (c *Connection) closeIdle() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return
+	}
+	if idle := time.Since(c.lastActivity); idle < c.idleTimeout {
+		c.idleTimer.Reset(c.idleTimeout - idle) // activity raced with the timer firing
+		return
+	}
 	c.conn.Close()
 	c.conn = nil
-	delete(connectionCache, c.host) // connection is dead, no need to cache any more
+	c.logInfo("closed idle connection")
+}
+
+// Default dialer, connecting to the device via TCP
+func (c *Connection) dialTCP(ctx context.Context, address string) (net.Conn, error) {
+	var d net.Dialer
+	return d.DialContext(ctx, "tcp", address)
+}
+
+// Returns the network address of the device, using the default port for RCT unless the host specifies one
+func (c *Connection) address() string {
+	if _, _, err := net.SplitHostPort(c.host); err == nil {
+		return c.host
+	}
+	return net.JoinHostPort(c.host, "8899")
+}
+
+// Re-establishes the connection to the device, counting the reconnect
+func (c *Connection) reconnect() error {
+	atomic.AddUint64(&c.stats.Reconnects, 1)
+	start := c.clock.Now()
+	delay := c.backoffInitial
+	for {
+		err := c.connect()
+		if err == nil {
+			c.logInfo("reconnected")
+			return nil
+		}
+		c.logError("reconnect failed", err)
+		if c.backoffMaxElapsed <= 0 || c.clock.Now().Sub(start)+delay > c.backoffMaxElapsed {
+			return err
+		}
+		select {
+		case <-c.clock.After(delay):
+		case <-c.closed:
+			return err // no point in retrying for a closed connection
+		}
+		if delay *= 2; delay > c.backoffMax {
+			delay = c.backoffMax
+		}
+	}
+}
+
+// Closes the RCT device connection
+func (c *Connection) Close() {
+	c.closeOnce.Do(func() { close(c.closed) }) // abort reconnect retries, which hold the lock
+	c.mu.Lock()
+	if c.idleTimer != nil {
+		c.idleTimer.Stop()
+	}
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+	c.mu.Unlock()
+
+	connectionCacheMu.Lock()
+	if connectionCache[c.host] == c {
+		delete(connectionCache, c.host) // connection is dead, no need to cache any more
+	}
+	connectionCacheMu.Unlock()
 }
 
 // Sends the given RCT datagram via the connection
 func (c *Connection) Send(rdb *DatagramBuilder) (int, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	return c.send(rdb)
+	return c.send(rdb, nil)
 }
 
-func (c *Connection) send(rdb *DatagramBuilder) (int, error) {
+// Sends the frame of the given builder, logging the given datagram it was built from, or nil if built otherwise
+func (c *Connection) send(rdb *DatagramBuilder, dg *Datagram) (int, error) {
 	// ensure active connection
 	if c.conn == nil {
-		if err := c.connect(); err != nil {
+		if err := c.reconnect(); err != nil {
 			return 0, err
 		}
 	}
 
-	// fmt.Printf("Sending %v\n", c.Builder.String())
-	n, err := c.conn.Write(rdb.Bytes())
+	c.parser.Reset() // responses retained from earlier reads are stale once a new request is sent
+	c.logSend(rdb, dg)
+	n, err := c.write(rdb.Bytes())
 	// single retry on error when sending
 	if err != nil {
-		// fmt.Printf("Read %d bytes error %v\n", n, err)
+		c.logError("send failed, retrying", err)
+		atomic.AddUint64(&c.stats.Retries, 1)
 		c.conn.Close()
-		// fmt.Printf("Error reconnecting: %v\n", err)
-		if err := c.connect(); err != nil {
+		if err := c.reconnect(); err != nil {
 			return 0, err
 		}
-		n, err = c.conn.Write(rdb.Bytes())
-		// fmt.Printf("Read %d bytes error %v\n", n, err)
+		n, err = c.write(rdb.Bytes())
+		if err != nil {
+			c.logError("send failed", err)
+			c.conn.Close()
+			c.conn = nil
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				return n, fmt.Errorf("%w: %v", ErrTimeout, err)
+			}
+			return n, fmt.Errorf("%w: %v", ErrDisconnected, err)
+		}
+	}
+	return n, nil
+}
+
+// Writes the given bytes to the device within the write timeout, treating a short write as failure
+func (c *Connection) write(b []byte) (int, error) {
+	if c.minSendInterval > 0 {
+		// pace frames, as the device is easily overwhelmed by back-to-back requests
+		if wait := c.minSendInterval - c.clock.Now().Sub(c.lastSend); wait > 0 {
+			<-c.clock.After(wait)
+		}
+		c.lastSend = c.clock.Now()
+	}
+	if err := c.conn.SetWriteDeadline(time.Now().Add(WriteTimeout)); err != nil {
+		return 0, err
+	}
+	n, err := c.conn.Write(b)
+	if err == nil && n < len(b) {
+		err = io.ErrShortWrite
+	}
+	if err == nil {
+		c.touch()
 	}
 	return n, err
 }
 
-// Receives an RCT response via the connection
+// Receives an RCT response via the connection. A frame cut off by the end of a read is completed by further reads
+// until ReadTimeout, after which ErrTimeout is returned and the connection is dropped.
 func (c *Connection) Receive() (*Datagram, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	return c.receive()
+	return c.receive(0, ReadTimeout)
 }
 
-// Receives an RCT response via the connection
-func (c *Connection) receive() (dg *Datagram, err error) {
+// Receives an RCT response via the connection, waiting up to the given timeout and skipping duplicates other than
+// responses for the awaited identifier, or for any identifier if zero
+func (c *Connection) receive(awaited Identifier, timeout time.Duration) (dg *Datagram, err error) {
 	// ensure active connection
 	if c.conn == nil {
-		if err := c.connect(); err != nil {
+		if err := c.reconnect(); err != nil {
 			return nil, err
 		}
 	}
 
-	c.parser.Reset()
-	c.parser.length, err = c.conn.Read(c.parser.buffer)
+	if err := c.conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+	for {
+		dg, err = c.receiveFrame()
+		if err != nil || !c.duplicate(dg, awaited) {
+			return dg, err
+		}
+	}
+}
+
+// Receives the next frame via the connection, with the read deadline already set
+func (c *Connection) receiveFrame() (dg *Datagram, err error) {
+	// bytes retained after the previous frame may hold the next one already, e.g. if two arrived in one read
+	c.parser.compact()
+	if c.parser.length > 0 {
+		if dg, err = c.parser.Parse(); err != nil && !c.parser.partial() {
+			c.parser.Reset() // retained bytes hold no frame
+		}
+	}
+	for c.parser.state != Done {
+		// keep reading while a frame has started but is incomplete, as large frames may arrive in several segments
+		n, rerr := c.conn.Read(c.parser.buffer[c.parser.length:])
+		if c.capture != nil && n > 0 {
+			if _, err := c.capture.Write(c.parser.buffer[c.parser.length : c.parser.length+n]); err != nil {
+				c.logError("capture failed", err) // capturing is best effort and must not disturb the connection
+			}
+		}
+		c.parser.length += n
+		atomic.AddUint64(&c.stats.BytesReceived, uint64(n))
+		if rerr != nil {
+			// drop the connection, as a late response would be mistaken for the answer to the next request
+			c.conn.Close()
+			c.conn = nil
+			if ne, ok := rerr.(net.Error); ok && ne.Timeout() {
+				atomic.AddUint64(&c.stats.QueryTimeouts, 1)
+				c.logError("receive timed out", rerr)
+				err = fmt.Errorf("%w: %v", ErrTimeout, rerr)
+			} else {
+				c.logError("receive failed", rerr)
+				err = fmt.Errorf("%w: %v", ErrDisconnected, rerr)
+			}
+			c.reportError(err)
+			return nil, err
+		}
+		c.touch()
+
+		dg, err = c.parser.Parse()
+		if err == nil || !c.parser.partial() {
+			break
+		}
+	}
+	raw := c.parser.buffer[:c.parser.length]
+	if c.parser.crcErrors > 0 {
+		atomic.AddUint64(&c.stats.CRCErrors, uint64(c.parser.crcErrors))
+		if err == nil { // a corrupted frame was skipped before the valid one
+			c.reportError(RecoverableError{fmt.Sprintf("discarded %d frames with CRC mismatch in % X", c.parser.crcErrors, raw)})
+		}
+	}
 	if err != nil {
+		atomic.AddUint64(&c.stats.ParseErrors, 1)
+		c.logError("parse failed", err, "data", hex.EncodeToString(raw))
+		c.reportError(RecoverableError{fmt.Sprintf("%v in % X", err, raw)})
 		return dg, err
 	}
-	// fmt.Printf("Received %d bytes: %v\n", c.Parser.Len, c.Parser.Buffer[:c.Parser.Len])
+	if c.onResync != nil && c.parser.start > 0 {
+		c.onResync(append([]byte(nil), raw[:c.parser.start]...))
+	}
+	atomic.AddUint64(&c.stats.Received, 1)
+	c.logReceive(dg)
+	return dg, nil
+}
+
+// Returns a reset datagram builder from the pool, to be returned with putBuilder once its frame is sent
+func (c *Connection) getBuilder() *DatagramBuilder {
+	builder := c.builders.Get().(*DatagramBuilder)
+	builder.Reset()
+	return builder
+}
+
+// Returns the given datagram builder to the pool
+func (c *Connection) putBuilder(builder *DatagramBuilder) {
+	c.builders.Put(builder)
+}
 
-	return c.parser.Parse()
+// Reports whether the given received datagram repeats the previous one within the window of WithDedup, and records
+// it as the previous one otherwise. Responses for the awaited identifier are never dropped, as a repeated query may
+// legitimately receive an unchanged value again.
+func (c *Connection) duplicate(dg *Datagram, awaited Identifier) bool {
+	if c.dedupWindow <= 0 {
+		return false
+	}
+	now := c.clock.Now()
+	last := c.lastReceived
+	if last != nil && dg.Id != awaited && now.Sub(c.lastReceivedAt) <= c.dedupWindow &&
+		dg.Cmd == last.Cmd && dg.Id == last.Id && bytes.Equal(dg.Data, last.Data) {
+		c.logInfo("dropped duplicate", "id", dg.Id.String())
+		return true
+	}
+	c.lastReceived, c.lastReceivedAt = dg, now
+	return false
+}
 
-	// dg, err=c.Parser.Parse()
-	// fmt.Printf("Received datagram %s error %v\n", dg.String(), err)
-	// return dg, err
+// Passes the given error to the error callback, if configured
+func (c *Connection) reportError(err error) {
+	if c.onError != nil {
+		c.onError(err)
+	}
 }
 
-// Queries the given identifier on the RCT device, returning its value as a datagram
+// Queries the given identifier on the RCT device, returning its value as a datagram.
+// Concurrent queries for the same identifier share a single network round-trip and its result. Queries for
+// different identifiers take turns on the connection, each awaiting its own response, so none are dropped under load.
 func (c *Connection) Query(id Identifier) (*Datagram, error) {
+	dg, _, err := c.queryShared(id)
+	return dg, err
+}
+
+// Like Query, additionally returning the time the datagram was received, which is in the past for cache hits
+func (c *Connection) QueryTimed(id Identifier) (*Datagram, time.Time, error) {
+	dg, _, err := c.queryShared(id)
+	if dg == nil {
+		return nil, time.Time{}, err
+	}
+	if last, ts, ok := c.cache.Last(id); ok && last == dg {
+		return dg, ts, err
+	}
+	return dg, c.clock.Now(), err
+}
+
+// Like Query, additionally reporting whether the datagram was served from the cache instead of the network
+func (c *Connection) queryShared(id Identifier) (*Datagram, bool, error) {
+	c.flightMu.Lock()
+	if f, ok := c.inflight[id]; ok {
+		c.flightMu.Unlock()
+		<-f.done
+		return f.dg, f.fromCache, f.err
+	}
+	f := &flight{done: make(chan struct{})}
+	c.inflight[id] = f
+	c.flightMu.Unlock()
+
+	f.dg, f.fromCache, f.err = c.query(id, c.cache.timeout, ReadTimeout)
+
+	c.flightMu.Lock()
+	delete(c.inflight, id)
+	c.flightMu.Unlock()
+	close(f.done)
+	return f.dg, f.fromCache, f.err
+}
+
+// Queries the given identifier on the RCT device, always performing a network round-trip and updating the cache
+// with the result. Unlike Query, it never shares the response of a query issued earlier, e.g. to verify a write.
+func (c *Connection) QueryFresh(id Identifier) (*Datagram, error) {
+	dg, _, err := c.query(id, noCache, ReadTimeout)
+	return dg, err
+}
+
+// Drops the cached value of the given identifier, so the next query reads it from the RCT device
+func (c *Connection) Invalidate(id Identifier) {
+	c.cache.Delete(id)
+}
+
+// Drops all cached values, e.g. after an inverter restart, so the next queries read them from the RCT device
+func (c *Connection) InvalidateCache() {
+	c.cache.Clear()
+}
+
+// Like Query, but waits up to the given timeout for the response instead of ReadTimeout, e.g. for slow registers.
+// Cached values are only served if they are at most as old as the timeout, and concurrent queries for the same
+// identifier are not shared.
+func (c *Connection) QueryWithTimeout(id Identifier, timeout time.Duration) (*Datagram, error) {
+	dg, _, err := c.query(id, timeout, timeout)
+	return dg, err
+}
+
+// Checks if the RCT device is alive by reading the inverter state, bypassing the cache. Waits for the response
+// until the context deadline, or PingTimeout if it has none. Returns nil for a valid response, ErrTimeout if none
+// arrived, ErrDisconnected if the device is unreachable, a RecoverableError if the response was malformed,
+// or the context error if it is done.
+func (c *Connection) Ping(ctx context.Context) error {
+	timeout := PingTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	dg, _, err := c.query(InverterState, noCache, timeout)
+	if err != nil {
+		return err
+	}
+	_, err = dg.Uint8()
+	return err
+}
+
+// Maximum cache age for query which bypasses the cache
+const noCache time.Duration = -1
+
+// Queries the given identifier on the RCT device, from the cache if the cached value is at most the given age old,
+// waiting up to the given timeout for the response. Reports whether the datagram was served from the cache.
+func (c *Connection) query(id Identifier, maxAge, timeout time.Duration) (*Datagram, bool, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if dg, ok := c.cache.Get(id); ok {
-		return dg, nil
+	atomic.AddUint64(&c.stats.Queries, 1)
+	if dg, ok := c.cache.GetMaxAge(id, maxAge); ok {
+		atomic.AddUint64(&c.stats.CacheHits, 1)
+		return dg, true, nil
 	}
+	atomic.AddUint64(&c.stats.CacheMisses, 1)
 
-	builder := NewDatagramBuilder()
-	builder.Build(&Datagram{Read, id, nil})
-	if _, err := c.send(builder); err != nil {
-		return nil, err
+	builder := c.getBuilder()
+	defer c.putBuilder(builder)
+	req := &Datagram{Read, id, nil}
+	builder.Build(req)
+	if _, err := c.send(builder, req); err != nil {
+		return c.staleOnError(id, err)
 	}
 
-	dg, err := c.receive()
+	// a timed out receive drops the transport, so a late response is never mistaken for the answer to a later query
+	dg, err := c.receive(id, timeout)
 	if err != nil {
-		return nil, err
+		return c.staleOnError(id, err)
 	}
-	if dg.Cmd != Response || dg.Id != id {
-		return nil, RecoverableError{fmt.Sprintf("invalid response to read of %08X: %v", id, dg)}
+	if dg.Id != id && !dg.Id.Known() {
+		// framing slip, where payload bytes of an earlier frame were taken as identifier; resync on a fresh connection
+		c.conn.Close()
+		c.conn = nil
+		atomic.AddUint64(&c.stats.ParseErrors, 1)
+		err := RecoverableError{fmt.Sprintf("response with unknown identifier %08X to read of %08X, dropped", uint32(dg.Id), uint32(id))}
+		c.logError("framing slip", err)
+		c.reportError(err)
+		return nil, false, err
+	}
+	if (dg.Cmd != Response && dg.Cmd != LongResponse) || dg.Id != id {
+		return nil, false, RecoverableError{fmt.Sprintf("invalid response to read of %08X: %v", id, dg)}
 	}
 	c.cache.Put(dg)
+	c.notifyWatchers(dg)
 
-	return dg, nil
+	return dg, false, nil
+}
+
+// Returns the last value received for the given identifier alongside a StaleError wrapping the given error, if it is
+// recent enough for WithStaleOnError, or for a timeout with WithServeStaleOnTimeout. Returns only the error otherwise.
+func (c *Connection) staleOnError(id Identifier, err error) (*Datagram, bool, error) {
+	maxStale := c.maxStale
+	if maxStale <= 0 && c.serveStale && errors.Is(err, ErrTimeout) {
+		maxStale = math.MaxInt64 // any age
+	}
+	if maxStale <= 0 {
+		return nil, false, err
+	}
+	last, ts, ok := c.cache.Last(id)
+	if !ok {
+		return nil, false, err
+	}
+	age := c.clock.Now().Sub(ts)
+	if age > maxStale {
+		return nil, false, err
+	}
+	return last, true, StaleError{age, err}
+}
+
+// Sends the given datagram to the RCT device and returns the response for the same identifier, bypassing the cache.
+// Allows issuing arbitrary commands, e.g. for identifiers not covered by the higher-level methods.
+func (c *Connection) Request(dg *Datagram) (*Datagram, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	builder := c.getBuilder()
+	defer c.putBuilder(builder)
+	if err := builder.BuildChecked(dg); err != nil {
+		return nil, err
+	}
+	if _, err := c.send(builder, dg); err != nil {
+		return nil, err
+	}
+	res, err := c.receive(dg.Id, ReadTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if res.Id != dg.Id {
+		return nil, RecoverableError{fmt.Sprintf("invalid response to %s of %08X: %v", dg.Cmd, uint32(dg.Id), res)}
+	}
+	return res, nil
 }
 
-// Queries the given identifier on the RCT device, returning its value as a float32
+// Queries the given identifier on the RCT device, returning its value as a float32.
+// Values rejected by the configured validator are dropped from the cache and returned as RecoverableError.
 func (c *Connection) QueryFloat32(id Identifier) (val float32, err error) {
+	val, _, err = c.QueryFloat32Cached(id)
+	return val, err
+}
+
+// Like QueryFloat32, additionally reporting whether the value was served from the cache instead of the network,
+// e.g. to tune cache timeouts or count network round-trips
+func (c *Connection) QueryFloat32Cached(id Identifier) (val float32, fromCache bool, err error) {
+	dg, fromCache, qerr := c.queryShared(id)
+	if qerr != nil && !IsStale(qerr) {
+		return 0, false, qerr
+	}
+	val, err = dg.Float32()
+	if err != nil {
+		return 0, false, err
+	}
+	if c.validator != nil && !c.validator(id, val) {
+		c.cache.Delete(id)
+		return 0, false, RecoverableError{fmt.Sprintf("implausible value %v for %08X", val, uint32(id))}
+	}
+	return val, fromCache, qerr
+}
+
+// Returns the last value received for the given identifier as a float32 and its age, without sending anything
+// to the RCT device, even if the value is older than the cache timeout. Returns ok=false if no value is cached.
+func (c *Connection) TryQueryFloat32(id Identifier) (val float32, age time.Duration, ok bool) {
+	dg, ts, ok := c.cache.Last(id)
+	if !ok {
+		return 0, 0, false
+	}
+	val, err := dg.Float32()
+	if err != nil {
+		return 0, 0, false
+	}
+	return val, c.clock.Now().Sub(ts), true
+}
+
+// Queries the given identifier on the RCT device, returning its value as an array of float32
+func (c *Connection) QueryFloat32s(id Identifier) (vals []float32, err error) {
+	dg, err := c.Query(id)
+	if err != nil {
+		return nil, err
+	}
+	return dg.Float32s()
+}
+
+// Queries the given identifier on the RCT device, returning its value as a uint32
+func (c *Connection) QueryUint32(id Identifier) (val uint32, err error) {
+	dg, err := c.Query(id)
+	if err != nil {
+		return 0, err
+	}
+	return dg.Uint32()
+}
+
+// Queries the given identifier on the RCT device, returning its value as an int16
+func (c *Connection) QueryInt16(id Identifier) (val int16, err error) {
 	dg, err := c.Query(id)
 	if err != nil {
 		return 0, err
 	}
-	return dg.Float32()
+	return dg.Int16()
 }
 
 // Queries the given identifier on the RCT device, returning its value as a uint16
@@ -175,3 +743,60 @@ func (c *Connection) QueryUint8(id Identifier) (val uint8, err error) {
 	}
 	return dg.Uint8()
 }
+
+// Queries the given identifier on the RCT device, returning its value as a bool
+func (c *Connection) QueryBool(id Identifier) (val bool, err error) {
+	dg, err := c.Query(id)
+	if err != nil {
+		return false, err
+	}
+	return dg.Bool()
+}
+
+// Queries the given identifier on the RCT device, returning its value as a timestamp in the location configured
+// with WithTimeLocation, or TimeLocation by default
+func (c *Connection) QueryTime(id Identifier) (val time.Time, err error) {
+	dg, err := c.Query(id)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if val, err = dg.Time(); err == nil && c.timeLoc != nil {
+		val = val.In(c.timeLoc)
+	}
+	return val, err
+}
+
+// Queries the battery status condition flags on the RCT device
+func (c *Connection) QueryBatteryStatus() (val BatteryStatus, err error) {
+	v, err := c.QueryUint32(BatteryBatStatus)
+	if err != nil {
+		return 0, err
+	}
+	return BatteryStatus(v), nil
+}
+
+// Queries the battery state of charge strategy on the RCT device. Returns an error for undocumented values.
+func (c *Connection) QuerySocStrategy() (val SocStrategy, err error) {
+	v, err := c.QueryUint8(PowerMngSocStrategy)
+	if err != nil {
+		return 0, err
+	}
+	if SocStrategy(v) > SOCTargetSchedule {
+		return 0, RecoverableError{fmt.Sprintf("unknown SoC strategy %d", v)}
+	}
+	return SocStrategy(v), nil
+}
+
+// Queries the given identifiers on the RCT device sequentially, returning their values as datagrams in the same order.
+// Each identifier not served from the cache takes its own network round-trip. Stops at the first failure.
+func (c *Connection) QueryMultiple(ids ...Identifier) ([]*Datagram, error) {
+	dgs := make([]*Datagram, len(ids))
+	for i, id := range ids {
+		dg, err := c.Query(id)
+		if err != nil {
+			return nil, fmt.Errorf("querying %s: %w", id, err)
+		}
+		dgs[i] = dg
+	}
+	return dgs, nil
+}
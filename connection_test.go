@@ -0,0 +1,1305 @@
+package rct
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// A mock RCT device, answering each request with the datagram returned by its handler (or not at all if nil)
+type mockServer struct {
+	listener net.Listener
+	handler  func(req *Datagram) *Datagram
+	requests uint64
+}
+
+// Starts a mock RCT device on a random local port, stopped automatically at the end of the test
+func newMockServer(t testing.TB, handler func(req *Datagram) *Datagram) *mockServer {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &mockServer{listener: l, handler: handler}
+	go s.serve()
+	t.Cleanup(func() { l.Close() })
+	return s
+}
+
+// Returns the address of the mock device
+func (s *mockServer) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Returns the number of requests received by the mock device so far
+func (s *mockServer) Requests() uint64 {
+	return atomic.LoadUint64(&s.requests)
+}
+
+// Accepts connections until the listener is closed
+func (s *mockServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// Answers requests on a single connection until it is closed
+func (s *mockServer) serveConn(conn net.Conn) {
+	defer conn.Close()
+	buf := make([]byte, 1024)
+	parser := NewDatagramParser()
+	builder := NewDatagramBuilder()
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return
+		}
+		for _, frame := range splitFrames(buf[:n]) {
+			parser.Reset()
+			parser.length = copy(parser.buffer, frame)
+			req, err := parser.Parse()
+			if err != nil {
+				continue
+			}
+			atomic.AddUint64(&s.requests, 1)
+			if res := s.handler(req); res != nil {
+				builder.Build(res)
+				if _, err := conn.Write(builder.Bytes()); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Splits a transmission into frames at each unescaped start byte, as requests sent back-to-back may arrive in one read
+func splitFrames(buf []byte) (frames [][]byte) {
+	start, escaped := -1, false
+	for i, b := range buf {
+		if !escaped && b == 0x2b {
+			if start >= 0 {
+				frames = append(frames, buf[start:i])
+			}
+			start = i
+		}
+		escaped = !escaped && b == 0x2d
+	}
+	if start >= 0 {
+		frames = append(frames, buf[start:])
+	}
+	return frames
+}
+
+// A mock RCT device register file, answering reads with the stored value and storing writes without answering
+type mockRegisters struct {
+	mu     sync.Mutex
+	values map[Identifier][]byte
+	ignore map[Identifier]bool // writes to these identifiers are silently not applied
+}
+
+// Handles a request against the register file
+func (m *mockRegisters) handle(req *Datagram) *Datagram {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch req.Cmd {
+	case Read:
+		return &Datagram{Response, req.Id, m.values[req.Id]}
+	case Write:
+		if !m.ignore[req.Id] {
+			m.values[req.Id] = req.Data
+		}
+	}
+	return nil
+}
+
+// Returns the stored value for the given identifier
+func (m *mockRegisters) get(id Identifier) []byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.values[id]
+}
+
+// Returns a handler answering every read with the given payload
+func respondWith(data []byte) func(req *Datagram) *Datagram {
+	return func(req *Datagram) *Datagram {
+		return &Datagram{Response, req.Id, data}
+	}
+}
+
+// Test if a query against an unresponsive device returns ErrTimeout
+func TestQueryTimeout(t *testing.T) {
+	defer func(d time.Duration) { ReadTimeout = d }(ReadTimeout)
+	ReadTimeout = 50 * time.Millisecond
+
+	srv := newMockServer(t, func(req *Datagram) *Datagram { return nil })
+	conn, err := NewConnection(srv.Addr(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	_, err = conn.Query(BatterySoC)
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("error got %v, should be %v", err, ErrTimeout)
+	}
+	if errors.Is(err, ErrDisconnected) {
+		t.Errorf("error %v should not be %v", err, ErrDisconnected)
+	}
+	if s := conn.Stats(); s.QueryTimeouts != 1 {
+		t.Errorf("error got %d query timeouts, should be 1", s.QueryTimeouts)
+	}
+}
+
+// Test if a per-call timeout shorter than the device delay times out, while a longer one succeeds
+func TestQueryWithTimeout(t *testing.T) {
+	srv := newMockServer(t, func(req *Datagram) *Datagram {
+		time.Sleep(100 * time.Millisecond)
+		return &Datagram{Response, req.Id, EncodeFloat32(0.5)}
+	})
+	conn, err := NewConnection(srv.Addr(), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	start := time.Now()
+	if _, err := conn.QueryWithTimeout(BatterySoC, 20*time.Millisecond); !errors.Is(err, ErrTimeout) {
+		t.Errorf("error got %v, should be %v", err, ErrTimeout)
+	}
+	if d := time.Since(start); d >= ReadTimeout {
+		t.Errorf("error short timeout took %v, at least the default %v", d, ReadTimeout)
+	}
+
+	dg, err := conn.QueryWithTimeout(BatterySoC, time.Second)
+	if err != nil || !bytes.Equal(dg.Data, EncodeFloat32(0.5)) {
+		t.Errorf("error got %v %v, should be 0.5", dg, err)
+	}
+	if _, err := conn.QueryWithTimeout(BatterySoC, time.Second); err != nil {
+		t.Errorf("error got %v, should be served from cache", err)
+	}
+	if r := srv.Requests(); r != 2 {
+		t.Errorf("error got %d requests, should be 2", r)
+	}
+}
+
+// Test if cached values older than the timeout of QueryWithTimeout are read from the device again
+func TestQueryWithTimeoutCacheAge(t *testing.T) {
+	srv := newMockServer(t, respondWith(EncodeFloat32(0.5)))
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	conn, err := NewConnection(srv.Addr(), time.Minute, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Query(BatterySoC); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(100 * time.Millisecond)
+	if _, err := conn.QueryWithTimeout(BatterySoC, 200*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if r := srv.Requests(); r != 1 {
+		t.Errorf("error got %d requests, should be 1 for entry younger than the timeout", r)
+	}
+	clock.Advance(200 * time.Millisecond)
+	if _, err := conn.QueryWithTimeout(BatterySoC, 200*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if r := srv.Requests(); r != 2 {
+		t.Errorf("error got %d requests, should be 2 for entry older than the timeout", r)
+	}
+}
+
+// Test if failed queries return the last value alongside a StaleError while it is recent enough
+func TestWithStaleOnError(t *testing.T) {
+	defer func(d time.Duration) { ReadTimeout = d }(ReadTimeout)
+	ReadTimeout = 50 * time.Millisecond
+
+	var silent int32
+	srv := newMockServer(t, func(req *Datagram) *Datagram {
+		if atomic.LoadInt32(&silent) != 0 {
+			return nil
+		}
+		return &Datagram{Response, req.Id, EncodeFloat32(0.5)}
+	})
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	conn, err := NewConnection(srv.Addr(), time.Minute, WithClock(clock), WithStaleOnError(5*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Query(BatterySoC); err != nil {
+		t.Fatal(err)
+	}
+
+	atomic.StoreInt32(&silent, 1)
+	clock.Advance(2 * time.Minute)
+	dg, err := conn.Query(BatterySoC)
+	var se StaleError
+	if dg == nil || !bytes.Equal(dg.Data, EncodeFloat32(0.5)) || !errors.As(err, &se) || se.Age != 2*time.Minute {
+		t.Errorf("error got %v %v, should be stale 0.5 of age 2m", dg, err)
+	}
+	if !errors.Is(err, ErrTimeout) || !IsStale(err) {
+		t.Errorf("error %v should be stale and wrap %v", err, ErrTimeout)
+	}
+	if v, err := conn.QueryFloat32(BatterySoC); v != 0.5 || !IsStale(err) {
+		t.Errorf("error got %f %v, should be stale 0.5", v, err)
+	}
+
+	clock.Advance(4 * time.Minute)
+	if dg, err := conn.Query(BatterySoC); dg != nil || IsStale(err) || !errors.Is(err, ErrTimeout) {
+		t.Errorf("error got %v %v beyond maximum age, should be %v", dg, err, ErrTimeout)
+	}
+
+	// the maximum age also bounds timeouts if serving stale values on timeout is enabled too
+	both := newConnection(srv.Addr(), time.Minute, WithClock(clock), WithStaleOnError(5*time.Minute), WithServeStaleOnTimeout(true))
+	defer both.Close()
+	both.cache.Put(&Datagram{Response, BatterySoC, EncodeFloat32(0.5)})
+	clock.Advance(6 * time.Minute)
+	if dg, err := both.Query(BatterySoC); dg != nil || IsStale(err) || !errors.Is(err, ErrTimeout) {
+		t.Errorf("error got %v %v beyond maximum age with both options, should be %v", dg, err, ErrTimeout)
+	}
+}
+
+// Test if pings succeed against a live device, and classify silent, unreachable and malformed devices
+func TestPing(t *testing.T) {
+	srv := newMockServer(t, respondWith(EncodeUint8(uint8(StateFeedIn))))
+	conn, err := NewConnection(srv.Addr(), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for i := 0; i < 2; i++ {
+		if err := conn.Ping(context.Background()); err != nil {
+			t.Errorf("error got %v, should be nil", err)
+		}
+	}
+	if r := srv.Requests(); r != 2 {
+		t.Errorf("error got %d requests, should be 2 bypassing the cache", r)
+	}
+
+	silent := newMockServer(t, func(req *Datagram) *Datagram { return nil })
+	conn, err = NewConnection(silent.Addr(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := conn.Ping(ctx); !errors.Is(err, ErrTimeout) {
+		t.Errorf("error got %v, should be %v", err, ErrTimeout)
+	}
+	<-ctx.Done()
+	if err := conn.Ping(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error got %v after deadline, should be %v", err, context.DeadlineExceeded)
+	}
+
+	malformed := newMockServer(t, respondWith(EncodeFloat32(0.5)))
+	conn, err = NewConnection(malformed.Addr(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := conn.Ping(context.Background()); !IsRecoverable(err) {
+		t.Errorf("error got %v, should be recoverable", err)
+	}
+
+	unreachable := newConnection("127.0.0.1:1", 0)
+	if err := unreachable.Ping(context.Background()); !errors.Is(err, ErrDisconnected) {
+		t.Errorf("error got %v, should be %v", err, ErrDisconnected)
+	}
+}
+
+// Test if a query against a device which drops the connection returns ErrDisconnected
+func TestQueryDisconnected(t *testing.T) {
+	srv := newMockServer(t, respondWith([]byte{0x3f, 0x00, 0x00, 0x00}))
+	conn, err := NewConnection(srv.Addr(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	srv.listener.Close()
+	conn.conn.Close() // simulate the device dropping the connection, the reconnect then fails
+
+	_, err = conn.Query(BatterySoC)
+	if !errors.Is(err, ErrDisconnected) {
+		t.Errorf("error got %v, should be %v", err, ErrDisconnected)
+	}
+	if errors.Is(err, ErrTimeout) {
+		t.Errorf("error %v should not be %v", err, ErrTimeout)
+	}
+}
+
+// Test if concurrent queries for the same identifier share a single request to the device
+func TestQueryCoalescing(t *testing.T) {
+	srv := newMockServer(t, func(req *Datagram) *Datagram {
+		time.Sleep(100 * time.Millisecond) // keep the first query in flight while the others arrive
+		return &Datagram{Response, req.Id, []byte{0x3f, 0x00, 0x00, 0x00}}
+	})
+	conn, err := NewConnection(srv.Addr(), 0) // no caching, so only coalescing can avoid duplicate reads
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	const n = 50
+	errs := make(chan error, n)
+	start := make(chan struct{})
+	for i := 0; i < n; i++ {
+		go func() {
+			<-start
+			val, err := conn.QueryFloat32(BatterySoC)
+			if err == nil && val != 0.5 {
+				err = fmt.Errorf("error got %f, should be 0.5", val)
+			}
+			errs <- err
+		}()
+	}
+	close(start)
+	for i := 0; i < n; i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+
+	if r := srv.Requests(); r != 1 {
+		t.Errorf("error got %d requests, should be 1", r)
+	}
+}
+
+// Test if many concurrent queries for distinct identifiers each receive the response to their own identifier
+func TestQueryConcurrentDistinct(t *testing.T) {
+	const n = 100
+	regs := &mockRegisters{values: make(map[Identifier][]byte)}
+	for i := 0; i < n; i++ {
+		regs.values[Identifier(0x10000000+i)] = EncodeUint16(uint16(i))
+	}
+	srv := newMockServer(t, regs.handle)
+	conn, err := NewConnection(srv.Addr(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	errs := make(chan error, n)
+	start := make(chan struct{})
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			<-start
+			val, err := conn.QueryUint16(Identifier(0x10000000 + i))
+			if err == nil && val != uint16(i) {
+				err = fmt.Errorf("error got %d, should be %d", val, i)
+			}
+			errs <- err
+		}(i)
+	}
+	close(start)
+	for i := 0; i < n; i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+	if r := srv.Requests(); r != n {
+		t.Errorf("error got %d requests, should be %d", r, n)
+	}
+}
+
+// Test if the value validator turns implausible values into recoverable errors
+func TestQueryFloat32Validator(t *testing.T) {
+	values := map[Identifier][]byte{
+		BatterySoC:      EncodeFloat32(1.5),                  // out of range
+		BatteryPowerW:   EncodeFloat32(float32(math.NaN())),  // not a number
+		SolarGenAPowerW: EncodeFloat32(float32(math.Inf(1))), // infinite
+		SolarGenBPowerW: EncodeFloat32(1234.5),               // plausible
+	}
+	srv := newMockServer(t, func(req *Datagram) *Datagram {
+		return &Datagram{Response, req.Id, values[req.Id]}
+	})
+	conn, err := NewConnection(srv.Addr(), time.Minute, WithValueValidator(DefaultValueValidator))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	for _, id := range []Identifier{BatterySoC, BatteryPowerW, SolarGenAPowerW} {
+		_, err := conn.QueryFloat32(id)
+		if _, ok := err.(RecoverableError); !ok {
+			t.Errorf("error %s got %v, should be RecoverableError", id, err)
+		}
+	}
+	if v, err := conn.QueryFloat32(SolarGenBPowerW); err != nil || v != 1234.5 {
+		t.Errorf("error got %f %v, should be 1234.5", v, err)
+	}
+
+	// rejected values are not served from the cache
+	before := srv.Requests()
+	conn.QueryFloat32(BatterySoC)
+	if srv.Requests() != before+1 {
+		t.Errorf("error rejected value served from cache")
+	}
+}
+
+// Test if connections can be created concurrently, sharing a single connection per host
+func TestNewConnectionConcurrent(t *testing.T) {
+	const hosts, perHost = 8, 8
+	srvs := make([]*mockServer, hosts)
+	for i := range srvs {
+		srvs[i] = newMockServer(t, respondWith(EncodeFloat32(0.5)))
+	}
+
+	var wg sync.WaitGroup
+	conns := make([][]*Connection, hosts)
+	for i := range srvs {
+		conns[i] = make([]*Connection, perHost)
+		for j := 0; j < perHost; j++ {
+			wg.Add(1)
+			go func(i, j int) {
+				defer wg.Done()
+				conn, err := NewConnection(srvs[i].Addr(), time.Minute, WithDialTimeout(time.Second))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if _, err := conn.QueryFloat32(BatterySoC); err != nil {
+					t.Error(err)
+				}
+				conns[i][j] = conn
+			}(i, j)
+		}
+	}
+	wg.Wait()
+
+	for i := range conns {
+		for j := range conns[i] {
+			if conns[i][j] != conns[i][0] {
+				t.Errorf("error host %d got distinct connections %d and 0", i, j)
+			}
+		}
+		if conns[i][0] != nil {
+			conns[i][0].Close()
+		}
+	}
+}
+
+// Test if a busy connection, which holds its lock, does not block connecting to or closing other hosts
+func TestNewConnectionBusyHost(t *testing.T) {
+	busySrv, otherSrv := newMockServer(t, respondWith(EncodeFloat32(0.5))), newMockServer(t, respondWith(EncodeFloat32(0.5)))
+	busy, err := NewConnection(busySrv.Addr(), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+
+	busy.mu.Lock() // e.g. a long read or reconnect backoff
+	waiting := make(chan *Connection)
+	go func() {
+		conn, _ := NewConnection(busySrv.Addr(), time.Minute)
+		waiting <- conn
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	done := make(chan error)
+	go func() {
+		conn, err := NewConnection(otherSrv.Addr(), time.Minute)
+		if err == nil {
+			conn.Close()
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(time.Second):
+		t.Error("error connecting to another host blocked by a busy connection")
+	}
+	busy.mu.Unlock()
+	if conn := <-waiting; conn != busy {
+		t.Errorf("error got a distinct connection to the busy host")
+	}
+}
+
+// Test if connecting to a closed port fails promptly with ErrDisconnected
+func TestNewConnectionFailFast(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	start := time.Now()
+	_, err = NewConnection(addr, 0)
+	if !errors.Is(err, ErrDisconnected) {
+		t.Errorf("error got %v, should be %v", err, ErrDisconnected)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("error took %v to fail", d)
+	}
+}
+
+// Test if a custom dialer is used for connecting and reconnecting
+func TestWithDialer(t *testing.T) {
+	srv := &mockServer{handler: respondWith(EncodeFloat32(0.5))}
+	dials := 0
+	dialer := func(ctx context.Context, address string) (net.Conn, error) {
+		dials++
+		if address != "inverter:8899" {
+			t.Errorf("error got address %s, should be inverter:8899", address)
+		}
+		client, server := net.Pipe()
+		go srv.serveConn(server)
+		return client, nil
+	}
+
+	conn, err := NewConnection("inverter", 0, WithDialer(dialer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if v, err := conn.QueryFloat32(BatterySoC); err != nil || v != 0.5 {
+		t.Errorf("error got %f %v, should be 0.5", v, err)
+	}
+	conn.mu.Lock()
+	conn.conn.Close() // drop the transport, forcing a reconnect via the dialer
+	conn.mu.Unlock()
+	if v, err := conn.QueryFloat32(BatterySoC); err != nil || v != 0.5 {
+		t.Errorf("error got %f %v, should be 0.5", v, err)
+	}
+	if dials != 2 {
+		t.Errorf("error got %d dials, should be 2", dials)
+	}
+}
+
+// Returns a dialer connecting to an in-memory device which answers each request with the next of the given raw transmissions
+func rawDialer(responses ...[]byte) func(ctx context.Context, address string) (net.Conn, error) {
+	segments := make([][][]byte, len(responses))
+	for i, res := range responses {
+		segments[i] = [][]byte{res}
+	}
+	return segmentedDialer(segments...)
+}
+
+// Returns a dialer to a pipe answering each request with the given responses, written as separate segments
+func segmentedDialer(responses ...[][]byte) func(ctx context.Context, address string) (net.Conn, error) {
+	return func(ctx context.Context, address string) (net.Conn, error) {
+		client, server := net.Pipe()
+		go func() {
+			defer server.Close()
+			buf := make([]byte, 1024)
+			for _, res := range responses {
+				if _, err := server.Read(buf); err != nil {
+					return
+				}
+				for _, segment := range res {
+					if _, err := server.Write(segment); err != nil {
+						return
+					}
+				}
+			}
+		}()
+		return client, nil
+	}
+}
+
+// Test if a connection with a CRC variant accepts frames checksummed with it, which the default rejects
+func TestWithCRC(t *testing.T) {
+	builder := newDatagramBuilderCRC(0x1021, 0x0000)
+	builder.Build(&Datagram{Response, BatterySoC, EncodeFloat32(0.5)})
+	res := append([]byte(nil), builder.Bytes()...)
+
+	conn := newConnection("inverter", 0, WithDialer(rawDialer(res)), WithCRC(0x1021, 0x0000))
+	defer conn.Close()
+	if v, err := conn.QueryFloat32(BatterySoC); err != nil || v != 0.5 {
+		t.Errorf("error got %f %v with CRC variant, should be 0.5", v, err)
+	}
+
+	conn = newConnection("inverter", 0, WithDialer(rawDialer(res)))
+	defer conn.Close()
+	if _, err := conn.QueryFloat32(BatterySoC); err == nil {
+		t.Errorf("error CRC variant accepted by default connection")
+	}
+}
+
+// Test if two responses arriving in a single read are both delivered, the second one by the next receive
+func TestReceiveCoalescedFrames(t *testing.T) {
+	builder := NewDatagramBuilder()
+	builder.Build(&Datagram{Response, BatterySoC, EncodeFloat32(0.5)})
+	both := append([]byte(nil), builder.Bytes()...)
+	builder.Build(&Datagram{Response, InverterACPowerW, EncodeFloat32(1500)})
+	both = append(both, builder.Bytes()...)
+
+	conn := newConnection("inverter", 0, WithDialer(rawDialer(both)))
+	defer conn.Close()
+	if v, err := conn.QueryFloat32(BatterySoC); err != nil || v != 0.5 {
+		t.Fatalf("error got %f %v, should be 0.5", v, err)
+	}
+	dg, err := conn.Receive()
+	if err != nil || dg.Id != InverterACPowerW || !bytes.Equal(dg.Data, EncodeFloat32(1500)) {
+		t.Errorf("error got %v %v, should be retained %s response", dg, err, InverterACPowerW.String())
+	}
+	if s := conn.Stats(); s.Received != 2 {
+		t.Errorf("error got %d received, should be 2", s.Received)
+	}
+}
+
+// Test if an echoed response is dropped with deduplication enabled, and delivered again without
+func TestWithDedup(t *testing.T) {
+	first := Encode(&Datagram{Response, BatterySoC, EncodeFloat32(0.5)})
+	second := Encode(&Datagram{Response, InverterACPowerW, EncodeFloat32(1500)})
+	frames := append(append(append([]byte(nil), first...), first...), second...)
+
+	for _, tc := range []struct {
+		opts []Option
+		want Identifier
+	}{
+		{[]Option{WithDedup(time.Second)}, InverterACPowerW},
+		{nil, BatterySoC},
+	} {
+		conn := newConnection("inverter", 0, append(tc.opts, WithDialer(rawDialer(frames)))...)
+		if _, err := conn.Query(BatterySoC); err != nil {
+			t.Fatal(err)
+		}
+		if dg, err := conn.Receive(); err != nil || dg.Id != tc.want {
+			t.Errorf("error got %v %v with %d options, should be %s", dg, err, len(tc.opts), tc.want.String())
+		}
+		conn.Close()
+	}
+}
+
+// Test if a response echoed after its query completed is dropped before the next query checks its response,
+// while a repeated query still accepts an unchanged value
+func TestWithDedupAcrossQueries(t *testing.T) {
+	soc := Encode(&Datagram{Response, BatterySoC, EncodeFloat32(0.5)})
+	power := Encode(&Datagram{Response, InverterACPowerW, EncodeFloat32(1500)})
+
+	conn := newConnection("inverter", 0, WithDedup(time.Second),
+		WithDialer(segmentedDialer([][]byte{soc}, [][]byte{soc, power}, [][]byte{soc})))
+	defer conn.Close()
+	if v, err := conn.QueryFloat32(BatterySoC); err != nil || v != 0.5 {
+		t.Fatalf("error got %f %v for first query, should be 0.5", v, err)
+	}
+	if v, err := conn.QueryFloat32(InverterACPowerW); err != nil || v != 1500 {
+		t.Errorf("error got %f %v after echo, should be 1500", v, err)
+	}
+	if dg, err := conn.QueryFresh(BatterySoC); err != nil || dg.Id != BatterySoC {
+		t.Errorf("error got %v %v for repeated query, should be %s", dg, err, BatterySoC.String())
+	}
+}
+
+// Test if CRC mismatches and malformed frames are passed to the error callback with their raw bytes
+func TestWithErrorCallback(t *testing.T) {
+	builder := NewDatagramBuilder()
+	builder.Build(&Datagram{Response, BatterySoC, EncodeFloat32(0.5)})
+	valid := append([]byte(nil), builder.Bytes()...)
+	corrupt := append([]byte(nil), valid...)
+	corrupt[len(corrupt)-1] ^= 0xff
+	garbage := []byte{0x2b, 0xff, 0x08, 0x95} // invalid command
+
+	var errs []error
+	conn, err := NewConnection("inverter", 0, WithDialer(rawDialer(append(corrupt, valid...), garbage)),
+		WithErrorCallback(func(err error) { errs = append(errs, err) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Query(BatterySoC); err != nil {
+		t.Errorf("error %v, valid frame after corrupt one should parse", err)
+	}
+	if _, err := conn.Query(BatterySoC); err == nil {
+		t.Errorf("error expected for garbage response")
+	}
+
+	if len(errs) != 2 {
+		t.Fatalf("error got %d callbacks %v, should be 2", len(errs), errs)
+	}
+	for i, raw := range [][]byte{corrupt, garbage} {
+		re, ok := errs[i].(RecoverableError)
+		if !ok {
+			t.Errorf("error callback %d got %T, should be RecoverableError", i, errs[i])
+			continue
+		}
+		if !strings.Contains(re.Error(), fmt.Sprintf("% X", raw)) {
+			t.Errorf("error callback %d got %q, should contain raw bytes % X", i, re.Error(), raw)
+		}
+	}
+}
+
+// Test if sending to a device which stops reading returns within the write timeout instead of blocking
+func TestSendWriteTimeout(t *testing.T) {
+	defer func(d time.Duration) { WriteTimeout = d }(WriteTimeout)
+	WriteTimeout = 50 * time.Millisecond
+
+	dialer := func(ctx context.Context, address string) (net.Conn, error) {
+		client, server := net.Pipe() // the server end never reads, so writes block
+		t.Cleanup(func() { server.Close() })
+		return client, nil
+	}
+	conn, err := NewConnection("inverter", 0, WithDialer(dialer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	builder := NewDatagramBuilder()
+	builder.Build(&Datagram{Read, BatterySoC, nil})
+	start := time.Now()
+	_, err = conn.Send(builder)
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("error got %v, should be %v", err, ErrTimeout)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("error send took %v", d)
+	}
+	if conn.isActive() {
+		t.Errorf("error connection still active after failed send")
+	}
+}
+
+// Test if an idle connection is closed after the idle timeout, and re-established on the next query
+func TestWithIdleTimeout(t *testing.T) {
+	srv := newMockServer(t, respondWith(EncodeFloat32(0.5)))
+	conn, err := NewConnection(srv.Addr(), 0, WithIdleTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Query(BatterySoC); err != nil {
+		t.Fatal(err)
+	}
+	if !conn.isActive() {
+		t.Fatalf("error connection closed before idle timeout")
+	}
+	time.Sleep(150 * time.Millisecond)
+	if conn.isActive() {
+		t.Fatalf("error connection still active after idle timeout")
+	}
+
+	if v, err := conn.QueryFloat32(BatterySoC); err != nil || v != 0.5 {
+		t.Errorf("error got %f %v after idle close, should be 0.5", v, err)
+	}
+	if s := conn.Stats(); s.Reconnects != 1 {
+		t.Errorf("error got %d reconnects, should be 1", s.Reconnects)
+	}
+}
+
+// Test if a large frame arriving in several segments is received completely
+func TestReceiveSegmentedLongResponse(t *testing.T) {
+	data := make([]byte, 1500)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	frame := longResponse(BatterySoC, data)
+
+	dialer := func(ctx context.Context, address string) (net.Conn, error) {
+		client, server := net.Pipe()
+		go func() {
+			defer server.Close()
+			buf := make([]byte, 1024)
+			if _, err := server.Read(buf); err != nil {
+				return
+			}
+			for _, segment := range [][]byte{frame[:10], frame[10:700], frame[700:]} {
+				if _, err := server.Write(segment); err != nil {
+					return
+				}
+			}
+		}()
+		return client, nil
+	}
+	conn, err := NewConnection("inverter", 0, WithDialer(dialer), WithBufferSize(4096))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	builder := NewDatagramBuilder()
+	builder.Build(&Datagram{Read, BatterySoC, nil})
+	if _, err := conn.send(builder, nil); err != nil {
+		t.Fatal(err)
+	}
+	dg, err := conn.receive(0, ReadTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dg.Cmd != LongResponse || string(dg.Data) != string(data) {
+		t.Errorf("error got %v with %d bytes, should be LongResponse with %d bytes", dg.Cmd, len(dg.Data), len(data))
+	}
+}
+
+// Test if failed reconnects are retried with backoff until the configured maximum elapsed time
+func TestWithReconnectBackoff(t *testing.T) {
+	var dials int32
+	dialer := func(ctx context.Context, address string) (net.Conn, error) {
+		if atomic.AddInt32(&dials, 1) == 1 {
+			client, server := net.Pipe()
+			server.Close() // first connection drops right away
+			return client, nil
+		}
+		return nil, errors.New("connection refused")
+	}
+	conn, err := NewConnection("inverter", 0, WithDialer(dialer),
+		WithReconnectBackoff(10*time.Millisecond, 40*time.Millisecond, 200*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	start := time.Now()
+	if _, err := conn.Query(BatterySoC); !errors.Is(err, ErrDisconnected) {
+		t.Errorf("error got %v, should be %v", err, ErrDisconnected)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("error gave up after %v, should retry for up to 200ms", elapsed)
+	}
+	if n := atomic.LoadInt32(&dials); n < 4 {
+		t.Errorf("error got %d dials, should retry several times", n)
+	}
+}
+
+// Test if queries on a connection which cannot be re-established return promptly without leaking goroutines
+func TestQueryDisconnectedNoLeak(t *testing.T) {
+	var dials int32
+	dialer := func(ctx context.Context, address string) (net.Conn, error) {
+		if atomic.AddInt32(&dials, 1) == 1 {
+			client, server := net.Pipe()
+			server.Close()
+			return client, nil
+		}
+		return nil, errors.New("connection refused")
+	}
+	conn, err := NewConnection("inverter", 0, WithDialer(dialer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	before := runtime.NumGoroutine()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := conn.Query(BatterySoC); !errors.Is(err, ErrDisconnected) {
+				t.Errorf("error got %v, should be %v", err, ErrDisconnected)
+			}
+		}()
+	}
+	wg.Wait()
+
+	conn.flightMu.Lock()
+	if n := len(conn.inflight); n != 0 {
+		t.Errorf("error %d queries still in flight", n)
+	}
+	conn.flightMu.Unlock()
+	for i := 0; runtime.NumGoroutine() > before && i < 100; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("error %d goroutines before, %d after", before, after)
+	}
+}
+
+// Test if TryQueryFloat32 returns the last received value and its age without sending, even after the cache timeout
+func TestTryQueryFloat32(t *testing.T) {
+	srv := newMockServer(t, respondWith(EncodeFloat32(0.5)))
+	conn, err := NewConnection(srv.Addr(), 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, _, ok := conn.TryQueryFloat32(BatterySoC); ok {
+		t.Errorf("error value returned before any query")
+	}
+	if _, err := conn.QueryFloat32(BatterySoC); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	v, age, ok := conn.TryQueryFloat32(BatterySoC)
+	if !ok || v != 0.5 {
+		t.Errorf("error got %v %v, should be 0.5 true", v, ok)
+	}
+	if age < 20*time.Millisecond {
+		t.Errorf("error got age %v, should be at least 20ms", age)
+	}
+	if n := srv.Requests(); n != 1 {
+		t.Errorf("error got %d requests, should be 1", n)
+	}
+}
+
+// Test if bytes skipped before a valid frame are passed to the resync callback
+func TestWithResyncCallback(t *testing.T) {
+	builder := NewDatagramBuilder()
+	builder.Build(&Datagram{Response, BatterySoC, EncodeFloat32(0.5)})
+	valid := append([]byte(nil), builder.Bytes()...)
+	corrupt := append([]byte(nil), valid...)
+	corrupt[len(corrupt)-1] ^= 0xff
+	junk := append([]byte{0x00, 0x13, 0x37}, corrupt...)
+
+	var discarded [][]byte
+	conn, err := NewConnection("inverter", 0, WithDialer(rawDialer(append(junk, valid...), valid)),
+		WithResyncCallback(func(b []byte) { discarded = append(discarded, b) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	for i := 0; i < 2; i++ {
+		if _, err := conn.Query(BatterySoC); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(discarded) != 1 || !bytes.Equal(discarded[0], junk) {
+		t.Errorf("error got %v, should be one callback with % X", discarded, junk)
+	}
+}
+
+// Test if a response whose identifier is really payload of a preceding frame is dropped, and the query recovers
+func TestQueryFramingSlip(t *testing.T) {
+	builder := NewDatagramBuilder()
+	builder.Build(&Datagram{Response, Identifier(0x3f000000), EncodeFloat32(0.5)}) // SoC payload read as identifier
+	slip := append([]byte(nil), builder.Bytes()...)
+	builder.Build(&Datagram{Response, BatterySoC, EncodeFloat32(0.5)})
+	valid := append([]byte(nil), builder.Bytes()...)
+
+	var dials int32
+	dialer := func(ctx context.Context, address string) (net.Conn, error) {
+		if atomic.AddInt32(&dials, 1) == 1 {
+			return rawDialer(slip)(ctx, address)
+		}
+		return rawDialer(valid)(ctx, address)
+	}
+	var errs []error
+	conn, err := NewConnection("inverter", time.Minute, WithDialer(dialer),
+		WithErrorCallback(func(err error) { errs = append(errs, err) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var re RecoverableError
+	if _, err := conn.Query(BatterySoC); !errors.As(err, &re) {
+		t.Errorf("error got %v, should be RecoverableError", err)
+	}
+	if _, _, ok := conn.cache.Last(Identifier(0x3f000000)); ok {
+		t.Errorf("error response with unknown identifier cached")
+	}
+	if v, err := conn.QueryFloat32(BatterySoC); err != nil || v != 0.5 {
+		t.Errorf("error got %f %v, should be 0.5 after resync", v, err)
+	}
+	if len(errs) != 1 || conn.Stats().ParseErrors != 1 {
+		t.Errorf("error got %d callbacks and %d parse errors, should be 1 each", len(errs), conn.Stats().ParseErrors)
+	}
+}
+
+// Test if closing a connection aborts reconnect retries instead of waiting for the backoff to expire
+func TestCloseAbortsReconnectBackoff(t *testing.T) {
+	var dials int32
+	dialer := func(ctx context.Context, address string) (net.Conn, error) {
+		if atomic.AddInt32(&dials, 1) == 1 {
+			client, server := net.Pipe()
+			server.Close()
+			return client, nil
+		}
+		return nil, errors.New("connection refused")
+	}
+	conn, err := NewConnection("inverter", 0, WithDialer(dialer), WithReconnectBackoff(time.Second, time.Second, time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := conn.Query(BatterySoC)
+		done <- err
+	}()
+	for atomic.LoadInt32(&dials) < 2 {
+		time.Sleep(time.Millisecond) // wait for the first failed reconnect
+	}
+	conn.Close()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrDisconnected) {
+			t.Errorf("error got %v, should be %v", err, ErrDisconnected)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("error query still retrying after close")
+	}
+}
+
+// Test if a read issued via Request returns the same response as Query, without using the cache
+func TestRequest(t *testing.T) {
+	srv := newMockServer(t, respondWith(EncodeFloat32(0.5)))
+	conn, err := NewConnection(srv.Addr(), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	queried, err := conn.Query(BatterySoC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requested, err := conn.Request(&Datagram{Read, BatterySoC, nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requested.Cmd != queried.Cmd || requested.Id != queried.Id || !bytes.Equal(requested.Data, queried.Data) {
+		t.Errorf("error got %s, should be %s", requested.String(), queried.String())
+	}
+	if n := srv.Requests(); n != 2 {
+		t.Errorf("error got %d requests, should be 2", n)
+	}
+	if _, err := conn.Request(&Datagram{Write, BatterySoC, make([]byte, 300)}); err == nil {
+		t.Errorf("error oversized request accepted")
+	}
+}
+
+// Test if late responses to timed out queries are discarded, and stale values served on timeout only if enabled
+func TestServeStaleOnTimeout(t *testing.T) {
+	defer func(d time.Duration) { ReadTimeout = d }(ReadTimeout)
+	ReadTimeout = 50 * time.Millisecond
+
+	for _, serveStale := range []bool{false, true} {
+		var n int32
+		srv := newMockServer(t, func(req *Datagram) *Datagram {
+			switch atomic.AddInt32(&n, 1) {
+			case 1:
+				return &Datagram{Response, req.Id, EncodeFloat32(0.5)}
+			case 2:
+				time.Sleep(150 * time.Millisecond) // answer after the query timed out
+				return &Datagram{Response, req.Id, EncodeFloat32(0.1)}
+			}
+			return &Datagram{Response, req.Id, EncodeFloat32(0.7)}
+		})
+		conn, err := NewConnection(srv.Addr(), 0, WithServeStaleOnTimeout(serveStale))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if v, err := conn.QueryFloat32(BatterySoC); err != nil || v != 0.5 {
+			t.Errorf("error got %f %v, should be 0.5", v, err)
+		}
+		v, err := conn.QueryFloat32(BatterySoC)
+		if serveStale && (!IsStale(err) || !errors.Is(err, ErrTimeout) || v != 0.5) {
+			t.Errorf("error got %f %v, should serve stale 0.5", v, err)
+		} else if !serveStale && !errors.Is(err, ErrTimeout) {
+			t.Errorf("error got %f %v, should be %v", v, err, ErrTimeout)
+		}
+		if v, err := conn.QueryFloat32(BatterySoC); err != nil || v != 0.7 {
+			t.Errorf("error got %f %v, should be 0.7 and not the late response", v, err)
+		}
+		conn.Close()
+	}
+}
+
+// Test if QueryFresh always performs a round-trip and updates the cache for subsequent queries
+func TestQueryFresh(t *testing.T) {
+	regs := &mockRegisters{values: map[Identifier][]byte{BatterySoC: EncodeFloat32(0.5)}}
+	srv := newMockServer(t, regs.handle)
+	conn, err := NewConnection(srv.Addr(), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Query(BatterySoC); err != nil {
+		t.Fatal(err)
+	}
+	regs.mu.Lock()
+	regs.values[BatterySoC] = EncodeFloat32(0.6)
+	regs.mu.Unlock()
+
+	if v, err := conn.QueryFloat32(BatterySoC); err != nil || v != 0.5 {
+		t.Errorf("error got %f %v, should be cached 0.5", v, err)
+	}
+	dg, err := conn.QueryFresh(BatterySoC)
+	if err != nil || !bytes.Equal(dg.Data, EncodeFloat32(0.6)) {
+		t.Errorf("error got %v %v, should be fresh 0.6", dg, err)
+	}
+	if v, err := conn.QueryFloat32(BatterySoC); err != nil || v != 0.6 {
+		t.Errorf("error got %f %v, should be updated 0.6", v, err)
+	}
+	if n := srv.Requests(); n != 2 {
+		t.Errorf("error got %d requests, should be 2", n)
+	}
+}
+
+// Test if values are reported as served from the cache only within the cache timeout
+func TestQueryFloat32Cached(t *testing.T) {
+	regs := &mockRegisters{values: map[Identifier][]byte{BatterySoC: EncodeFloat32(0.5)}}
+	srv := newMockServer(t, regs.handle)
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	conn, err := NewConnection(srv.Addr(), time.Minute, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	for i, want := range []bool{false, true, false} {
+		if i == 2 {
+			clock.Advance(2 * time.Minute)
+		}
+		v, fromCache, err := conn.QueryFloat32Cached(BatterySoC)
+		if err != nil || v != 0.5 || fromCache != want {
+			t.Errorf("error query %d got %f %v %v, should be 0.5 from cache %v", i, v, fromCache, err, want)
+		}
+	}
+	if n := srv.Requests(); n != 2 {
+		t.Errorf("error got %d requests, should be 2", n)
+	}
+}
+
+// Test if cache hits carry the time of the original read, and fresh reads the current time
+func TestQueryTimed(t *testing.T) {
+	srv := newMockServer(t, respondWith(EncodeFloat32(0.5)))
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	conn, err := NewConnection(srv.Addr(), time.Minute, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	read := clock.Now()
+	for i, want := range []time.Time{read, read} {
+		dg, ts, err := conn.QueryTimed(BatterySoC)
+		if err != nil || dg == nil || !ts.Equal(want) {
+			t.Errorf("error query %d got %v %v %v, should be received at %v", i, dg, ts, err, want)
+		}
+		clock.Advance(30 * time.Second)
+	}
+
+	clock.Advance(time.Minute)
+	if _, ts, err := conn.QueryTimed(BatterySoC); err != nil || !ts.Equal(clock.Now()) {
+		t.Errorf("error got %v %v after expiry, should be received at %v", ts, err, clock.Now())
+	}
+	if r := srv.Requests(); r != 2 {
+		t.Errorf("error got %d requests, should be 2", r)
+	}
+}
+
+// Test if invalidated identifiers are read from the device again, while others remain cached
+func TestInvalidate(t *testing.T) {
+	srv := newMockServer(t, respondWith(EncodeFloat32(0.5)))
+	conn, err := NewConnection(srv.Addr(), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	query := func(ids ...Identifier) {
+		for _, id := range ids {
+			if _, err := conn.Query(id); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	query(BatterySoC, BatteryPowerW)
+	conn.Invalidate(BatterySoC)
+	query(BatterySoC, BatteryPowerW)
+	if r := srv.Requests(); r != 3 {
+		t.Errorf("error got %d requests after invalidating one identifier, should be 3", r)
+	}
+	conn.InvalidateCache()
+	query(BatterySoC, BatteryPowerW)
+	if r := srv.Requests(); r != 5 {
+		t.Errorf("error got %d requests after invalidating the cache, should be 5", r)
+	}
+}
+
+// Test if the battery status is queried as condition flags
+func TestQueryBatteryStatus(t *testing.T) {
+	srv := newMockServer(t, respondWith([]byte{0x00, 0x00, 0x00, 0x05}))
+	conn, err := NewConnection(srv.Addr(), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	s, err := conn.QueryBatteryStatus()
+	if err != nil || s == 0 || len(s.Bits()) != 2 || s.Bits()[1] != 2 {
+		t.Errorf("error got %v %v, should be bits 0 and 2", s, err)
+	}
+}
+
+// Test if bursts of concurrent queries are paced by the minimum send interval
+func TestWithMinSendInterval(t *testing.T) {
+	var mu sync.Mutex
+	var arrivals []time.Time
+	srv := newMockServer(t, func(req *Datagram) *Datagram {
+		mu.Lock()
+		arrivals = append(arrivals, time.Now())
+		mu.Unlock()
+		return &Datagram{Response, req.Id, EncodeFloat32(1)}
+	})
+	interval := 20 * time.Millisecond
+	conn, err := NewConnection(srv.Addr(), 0, WithMinSendInterval(interval))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var wg sync.WaitGroup
+	for _, id := range []Identifier{SolarGenAPowerW, SolarGenBPowerW, BatteryPowerW, InverterACPowerW, TotalGridPowerW} {
+		wg.Add(1)
+		go func(id Identifier) {
+			defer wg.Done()
+			if _, err := conn.Query(id); err != nil {
+				t.Error(err)
+			}
+		}(id)
+	}
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(arrivals) != 5 {
+		t.Fatalf("error got %d requests, should be 5", len(arrivals))
+	}
+	for i := 1; i < len(arrivals); i++ {
+		if gap := arrivals[i].Sub(arrivals[i-1]); gap < interval-5*time.Millisecond {
+			t.Errorf("error request %d arrived %v after the previous one, should be at least %v", i, gap, interval)
+		}
+	}
+}
+
+// Benchmark uncached queries against the mock device, reporting allocations per round-trip
+func BenchmarkQuery(b *testing.B) {
+	srv := newMockServer(b, respondWith(EncodeFloat32(0.5)))
+	conn, err := NewConnection(srv.Addr(), 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer conn.Close()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := conn.QueryFresh(BatterySoC); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -1,22 +1,37 @@
 package rct
 
+// Polynomial and initial value of the CRC-CCITT checksum used by RCT devices
+const (
+	DefaultCRCPoly uint16 = 0x1021
+	DefaultCRCInit uint16 = 0xffff
+)
+
 // Checksum for a RCT datagram
 type CRC struct {
 	crc   uint16
 	isOdd bool
+	poly  uint16
+	init  uint16
 }
 
-// Returns a new CRC
+// Returns a new CRC with the default polynomial and initial value
 func NewCRC() (c *CRC) {
+	return NewCRCWith(DefaultCRCPoly, DefaultCRCInit)
+}
+
+// Returns a new CRC with the given polynomial and initial value, e.g. for devices using a protocol variant
+func NewCRCWith(poly, init uint16) (c *CRC) {
 	return &CRC{
-		crc:   0xffff,
+		crc:   init,
 		isOdd: false,
+		poly:  poly,
+		init:  init,
 	}
 }
 
 // Resets the CRC
 func (c *CRC) Reset() {
-	c.crc = 0xffff
+	c.crc = c.init
 	c.isOdd = false
 }
 
@@ -28,7 +43,7 @@ func (c *CRC) Update(b byte) {
 		c15 := ((crc >> 15) & 1) == 1
 		crc <<= 1
 		if c15 != bit {
-			crc ^= 0x1021
+			crc ^= c.poly
 		}
 	}
 	c.crc = crc
@@ -42,3 +57,23 @@ func (c *CRC) Get() uint16 {
 	}
 	return c.crc
 }
+
+// Computes the CRC of a datagram with the given command, identifier and payload, as transmitted after the payload.
+// LongWrite and LongResponse datagrams are covered with their two length bytes.
+func ComputeCRC(cmd Command, id Identifier, data []byte) uint16 {
+	c := NewCRC()
+	c.Update(byte(cmd))
+	length := len(data) + 4
+	if cmd == LongWrite || cmd == LongResponse {
+		c.Update(byte(length >> 8))
+	}
+	c.Update(byte(length))
+	c.Update(byte(id >> 24))
+	c.Update(byte(id >> 16))
+	c.Update(byte(id >> 8))
+	c.Update(byte(id))
+	for _, b := range data {
+		c.Update(b)
+	}
+	return c.Get()
+}
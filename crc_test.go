@@ -0,0 +1,137 @@
+package rct
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// Test if computed CRCs match the trailing bytes of built frames, including odd lengths and long datagrams
+func TestComputeCRC(t *testing.T) {
+	if crc := ComputeCRC(Read, BatterySoC, nil); crc != 0x0d65 {
+		t.Errorf("error got %04X, should be 0D65", crc)
+	}
+
+	for _, dg := range []Datagram{
+		{Response, BatterySoC, EncodeFloat32(0.5)},
+		{Write, PowerMngSocStrategy, EncodeUint8(uint8(SOCTargetInternal))}, // odd length, padded
+		{LongResponse, BatterySoC, make([]byte, 300)},
+	} {
+		var raw []byte
+		if dg.Cmd == LongResponse {
+			raw = longResponse(dg.Id, dg.Data)
+		} else {
+			builder := NewDatagramBuilder()
+			builder.Build(&dg)
+			raw = builder.Bytes()
+		}
+		parsed, err := VerifyFrame(raw)
+		if err != nil {
+			t.Errorf("error %v verifying %s", err, dg.String())
+			continue
+		}
+		if parsed.Cmd != dg.Cmd || parsed.Id != dg.Id || string(parsed.Data) != string(dg.Data) {
+			t.Errorf("error got %s, should be %s", parsed.String(), dg.String())
+		}
+
+		crc := ComputeCRC(dg.Cmd, dg.Id, dg.Data)
+		var suffix []byte
+		for _, b := range []byte{byte(crc >> 8), byte(crc)} {
+			if b == 0x2b || b == 0x2d {
+				suffix = append(suffix, 0x2d)
+			}
+			suffix = append(suffix, b)
+		}
+		if !bytes.HasSuffix(raw, suffix) {
+			t.Errorf("error got CRC %04X, frame ends in % X for %s", crc, raw[len(raw)-2:], dg.String())
+		}
+	}
+}
+
+// Test if VerifyFrame rejects frames with a CRC mismatch or truncation
+func TestVerifyFrameInvalid(t *testing.T) {
+	builder := NewDatagramBuilder()
+	builder.Build(&Datagram{Response, BatterySoC, EncodeFloat32(0.5)})
+	raw := append([]byte(nil), builder.Bytes()...)
+
+	corrupt := append([]byte(nil), raw...)
+	corrupt[len(corrupt)-1] ^= 0xff
+	var perr ParseError
+	if _, err := VerifyFrame(corrupt); !errors.As(err, &perr) || !perr.CRCMismatch || perr.CRCReceived == perr.CRCComputed ||
+		!bytes.Equal(perr.Raw, corrupt) {
+		t.Errorf("error got %v, should be a ParseError with CRC mismatch for % X", err, corrupt)
+	}
+	if _, err := VerifyFrame(append(corrupt, raw...)); !errors.As(err, &perr) || !perr.CRCMismatch || perr.State != Done {
+		t.Errorf("error got %v, should be a ParseError with CRC mismatch before a valid frame", err)
+	}
+	if _, err := VerifyFrame(raw[:len(raw)-3]); err == nil {
+		t.Errorf("error truncated frame accepted")
+	}
+}
+
+// Test if datagrams with start and escape bytes in length, identifier and payload round-trip through builder and
+// parser with matching CRCs, for both odd and even numbers of CRC bytes
+func TestCRCEscapedParity(t *testing.T) {
+	datagrams := []Datagram{
+		{Response, InverterACPowerW, EncodeFloat32(0.5)},          // escaped identifier byte
+		{Write, Identifier(0x2b2d2b2d), []byte{0x2b}},             // all identifier bytes escaped, odd
+		{Write, Identifier(0x2d000000), []byte{0x2d, 0x2b}},       // leading escape, even
+		{Response, BatterySoC, []byte{0x2b, 0x00, 0x2d}},          // escaped payload, odd
+		{Response, BatterySoC, []byte{0x00, 0x2d, 0x2d, 0x2b}},    // adjacent escapes at the end, even
+		{Response, BatterySoC, bytes.Repeat([]byte{0x2d}, 39)},    // length byte 0x2b, odd
+		{Response, BatterySoC, bytes.Repeat([]byte{0x2b}, 41)},    // length byte 0x2d, odd
+		{LongResponse, BatterySoC, bytes.Repeat([]byte{0x2b}, 7)}, // two length bytes, even
+		{LongResponse, BatterySoC, make([]byte, 0x2b00-4)},        // escaped high length byte, odd
+	}
+	parser := NewDatagramParserSize(0x4000)
+	builder := NewDatagramBuilder()
+	for _, dg := range datagrams {
+		builder.Build(&dg)
+		parser.Reset()
+		parser.length = copy(parser.buffer, builder.Bytes())
+		parsed, err := parser.Parse()
+		if err != nil {
+			t.Errorf("error %v parsing %s from % X", err, dg.String(), builder.Bytes())
+			continue
+		}
+		if parsed.Cmd != dg.Cmd || parsed.Id != dg.Id || !bytes.Equal(parsed.Data, dg.Data) {
+			t.Errorf("error got %s, should be %s", parsed.String(), dg.String())
+		}
+
+		// unescape the frame after the start byte, and compare its trailing CRC to the independently computed one
+		var tail []byte
+		for i, raw := 1, builder.Bytes(); i < len(raw); i++ {
+			if raw[i] == 0x2d {
+				i++
+			}
+			tail = append(tail, raw[i])
+		}
+		tail = tail[len(tail)-2:]
+		crc := ComputeCRC(dg.Cmd, dg.Id, dg.Data)
+		if got := uint16(tail[0])<<8 | uint16(tail[1]); got != crc {
+			t.Errorf("error frame carries CRC %04X, should be %04X for %s", got, crc, dg.String())
+		}
+	}
+}
+
+// Test if the default CRC is pinned to CRC-CCITT with initial value 0xffff, and variants differ from it
+func TestNewCRCWith(t *testing.T) {
+	for _, c := range []*CRC{NewCRC(), NewCRCWith(0x1021, 0xffff)} {
+		for _, b := range []byte{byte(Read), 4, 0x95, 0x99, 0x30, 0xbf} {
+			c.Update(b)
+		}
+		if crc := c.Get(); crc != 0x0d65 {
+			t.Errorf("error got %04X, should be 0D65", crc)
+		}
+	}
+
+	variant := NewCRCWith(0x1021, 0x0000)
+	variant.Update(0x01)
+	variant.Reset()
+	for _, b := range []byte{byte(Read), 4, 0x95, 0x99, 0x30, 0xbf} {
+		variant.Update(b)
+	}
+	if crc := variant.Get(); crc == 0x0d65 {
+		t.Errorf("error variant CRC equals the default %04X", crc)
+	}
+}
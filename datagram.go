@@ -4,8 +4,15 @@ import (
 	"encoding/binary"
 	"fmt"
 	"math"
+	"strings"
+	"time"
 )
 
+// TimeLocation is the location in which timestamps received from the RCT device are returned by Datagram.Time.
+// It is shared by all connections and read without synchronization, so set it before any use; use WithTimeLocation
+// for a location per connection instead.
+var TimeLocation = time.Local
+
 // Command type for the RCT device
 type Command uint8
 
@@ -19,7 +26,7 @@ const (
 	LongResponse
 	Reserved2
 	ReadPeriodically
-	Extension = iota + 0x3c - 0x09
+	Extension = iota + 0x3c - 0x09 // layout of extension datagrams is undocumented, they are parsed like plain ones
 )
 
 // Helper to convert command values to a human-readable representation
@@ -89,6 +96,20 @@ const (
 	BatterySoCTargetHigh      Identifier = 0xB84A38AB // float32 0 ... 1
 	BatterySoCTargetMin       Identifier = 0xCE266F0F // float32 0 ... 1
 	BatterySoCTargetMinIsland Identifier = 0x8EBF9574 // float32 0 ... 1
+	BatteryBatStatus          Identifier = 0x70A2AF4F // uint32, see BatteryStatus
+
+	// power management
+	//
+	PowerMngSocStrategy        Identifier = 0xF168B748 // uint8, see SocStrategy
+	PowerMngSocTargetSet       Identifier = 0xD1DFC969 // float32 0 ... 1, target for SOCTargetSOC strategy
+	PowerMngSocChargePowerW    Identifier = 0x1D2994EA // float32, battery charge power for SOCTargetSOC strategy
+	PowerMngUseGridPowerEnable Identifier = 0x36A9E9A6 // bool, allow charging the battery from the grid
+
+	// device information
+	//
+	DeviceName            Identifier = 0xEBC62737 // string, user-assigned device name
+	DeviceSerialNumber    Identifier = 0x7924ABD9 // string, inverter serial number
+	DeviceSoftwareVersion Identifier = 0xDDD1C2D0 // string, control software version
 )
 
 // Table to convert identifier values to human-readable strings
@@ -102,6 +123,7 @@ var identifiersToString = map[Identifier]string{
 	RealPowerW:       "Real power [W]",
 	TotalGridPowerW:  "Total grid power [W]",
 	BatterySoC:       "Battery state of charge",
+	S0ExternalPowerW: "S0 external power [W]",
 
 	// voltage
 	//
@@ -130,17 +152,41 @@ var identifiersToString = map[Identifier]string{
 	BatterySoCTargetHigh:      "Battery SoC target high",
 	BatterySoCTargetMin:       "Battery SoC target min",
 	BatterySoCTargetMinIsland: "Battery SoC target min island",
+	BatteryBatStatus:          "Battery status",
+
+	// power management
+	//
+	PowerMngSocStrategy:        "Power management SoC strategy",
+	PowerMngSocTargetSet:       "Power management SoC target",
+	PowerMngSocChargePowerW:    "Power management SoC charge power [W]",
+	PowerMngUseGridPowerEnable: "Power management use grid power",
+
+	// device information
+	//
+	DeviceName:            "Device name",
+	DeviceSerialNumber:    "Device serial number",
+	DeviceSoftwareVersion: "Device software version",
 }
 
 // Converts an identifier to a human-readable representation
 func (i Identifier) String() string {
+	registryMu.RLock()
 	s, ok := identifiersToString[i]
+	registryMu.RUnlock()
 	if !ok {
 		return "#INVALID"
 	}
 	return s
 }
 
+// Returns true if the identifier is known, i.e. built in or loaded with LoadRegisters
+func (i Identifier) Known() bool {
+	registryMu.RLock()
+	_, ok := identifiersToString[i]
+	registryMu.RUnlock()
+	return ok
+}
+
 // Inverter state type for InverterState responses from the RCT
 type InverterStates uint8
 
@@ -188,6 +234,66 @@ func (i InverterStates) String() string {
 	return inverterStateToString[i]
 }
 
+// Battery status type for BatteryBatStatus responses from the RCT, a set of condition flags. Although other tools
+// list the register as int32, it is decoded as uint32 so that all 32 flags are non-negative. RCT does not publicly
+// document the meaning of any bit, including whether 0 means healthy, so flags are reported by position only.
+type BatteryStatus uint32
+
+// Returns the positions of all set condition flags, in ascending order
+func (s BatteryStatus) Bits() []int {
+	var bits []int
+	for i := 0; i < 32; i++ {
+		if s&(1<<i) != 0 {
+			bits = append(bits, i)
+		}
+	}
+	return bits
+}
+
+// Converts a battery status to a human-readable string listing the set condition flags, or "none"
+func (s BatteryStatus) String() string {
+	if s == 0 {
+		return "none"
+	}
+	bits := s.Bits()
+	names := make([]string, len(bits))
+	for i, b := range bits {
+		names[i] = fmt.Sprintf("bit %d", b)
+	}
+	return strings.Join(names, ", ")
+}
+
+// Battery state of charge strategy type for PowerMngSocStrategy
+type SocStrategy uint8
+
+// Battery state of charge strategy values for PowerMngSocStrategy
+const (
+	SOCTargetSOC SocStrategy = iota
+	SOCTargetConstant
+	SOCTargetExternal
+	SOCTargetMiddleVoltage
+	SOCTargetInternal
+	SOCTargetSchedule
+)
+
+// Table to convert a SoC strategy value to a human-readable string
+var socStrategyToString []string = []string{
+	"SOC target",
+	"Constant",
+	"External",
+	"Middle battery voltage",
+	"Internal",
+	"Schedule",
+}
+
+// Converts a SoC strategy value to a human-readable string
+func (s SocStrategy) String() string {
+	if s > SOCTargetSchedule {
+		return "#INVALID"
+	}
+	return socStrategyToString[s]
+}
+
 // A RCT datagram
 type Datagram struct {
 	Cmd  Command
@@ -209,6 +315,37 @@ func (d *Datagram) Float32() (val float32, err error) {
 	return math.Float32frombits(binary.BigEndian.Uint32(d.Data)), nil
 }
 
+// Returns datagram body value as an array of float32, e.g. for identifiers holding one value per phase or tracker
+func (d *Datagram) Float32s() (vals []float32, err error) {
+	if len(d.Data)%4 != 0 {
+		return nil, RecoverableError{fmt.Sprintf("invalid data length %d, not a multiple of 4", len(d.Data))}
+	}
+
+	vals = make([]float32, len(d.Data)/4)
+	for i := range vals {
+		vals[i] = math.Float32frombits(binary.BigEndian.Uint32(d.Data[4*i:]))
+	}
+	return vals, nil
+}
+
+// Returns datagram body value as a uint32
+func (d *Datagram) Uint32() (val uint32, err error) {
+	if len(d.Data) != 4 {
+		return 0, RecoverableError{fmt.Sprintf("invalid data length %d", len(d.Data))}
+	}
+
+	return binary.BigEndian.Uint32(d.Data), nil
+}
+
+// Returns datagram body value as an int16
+func (d *Datagram) Int16() (val int16, err error) {
+	if len(d.Data) != 2 {
+		return 0, RecoverableError{fmt.Sprintf("invalid data length %d", len(d.Data))}
+	}
+
+	return int16(binary.BigEndian.Uint16(d.Data)), nil
+}
+
 // Returns datagram body value as a uint16
 func (d *Datagram) Uint16() (val uint16, err error) {
 	if len(d.Data) != 2 {
@@ -226,3 +363,63 @@ func (d *Datagram) Uint8() (val uint8, err error) {
 
 	return uint8(d.Data[0]), nil
 }
+
+// Returns datagram body value as a bool, which is true for any non-zero byte
+func (d *Datagram) Bool() (val bool, err error) {
+	if len(d.Data) != 1 {
+		return false, RecoverableError{fmt.Sprintf("invalid data length %d", len(d.Data))}
+	}
+
+	return d.Data[0] != 0, nil
+}
+
+// Returns datagram body value as a timestamp, interpreting it as uint32 seconds since the Unix epoch
+func (d *Datagram) Time() (val time.Time, err error) {
+	if len(d.Data) != 4 {
+		return time.Time{}, RecoverableError{fmt.Sprintf("invalid data length %d", len(d.Data))}
+	}
+
+	return time.Unix(int64(binary.BigEndian.Uint32(d.Data)), 0).In(TimeLocation), nil
+}
+
+// Encodes a float32 as a datagram body value
+func EncodeFloat32(v float32) []byte {
+	data := make([]byte, 4)
+	binary.BigEndian.PutUint32(data, math.Float32bits(v))
+	return data
+}
+
+// Encodes a uint16 as a datagram body value
+func EncodeUint16(v uint16) []byte {
+	data := make([]byte, 2)
+	binary.BigEndian.PutUint16(data, v)
+	return data
+}
+
+// Encodes a uint8 as a datagram body value
+func EncodeUint8(v uint8) []byte {
+	return []byte{v}
+}
+
+// Encodes a bool as a datagram body value
+func EncodeBool(v bool) []byte {
+	if v {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// Encodes an ASCII string as a datagram body value of the given length, padded with NUL bytes
+func EncodeString(s string, length int) ([]byte, error) {
+	if len(s) > length {
+		return nil, ValidationError{fmt.Sprintf("string of %d bytes exceeds length %d", len(s), length)}
+	}
+	data := make([]byte, length)
+	for i := 0; i < len(s); i++ {
+		if s[i] == 0 || s[i] > 0x7f {
+			return nil, ValidationError{fmt.Sprintf("invalid character %q at position %d, must be ASCII", s[i], i)}
+		}
+		data[i] = s[i]
+	}
+	return data, nil
+}
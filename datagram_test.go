@@ -0,0 +1,155 @@
+package rct
+
+import (
+	"testing"
+	"time"
+)
+
+// Test if a timestamp round-trips through builder, parser and the Time accessor
+func TestDatagramTime(t *testing.T) {
+	defer func(l *time.Location) { TimeLocation = l }(TimeLocation)
+	TimeLocation = time.UTC
+
+	builder := NewDatagramBuilder()
+	parser := NewDatagramParser()
+
+	expect := time.Date(2021, 6, 1, 12, 30, 45, 0, time.UTC)
+	epoch := uint32(expect.Unix()) // 0x60B6289D
+	in := Datagram{Response, 0x12345678, []byte{byte(epoch >> 24), byte(epoch >> 16), byte(epoch >> 8), byte(epoch)}}
+
+	builder.Build(&in)
+	parser.Reset()
+	parser.length = copy(parser.buffer, builder.Bytes())
+	dg, err := parser.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts, err := dg.Time()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ts.Equal(expect) || ts.Location() != time.UTC {
+		t.Errorf("error got %v, should be %v", ts, expect)
+	}
+
+	if _, err := (&Datagram{Response, 0x12345678, []byte{0x01, 0x02}}).Time(); err == nil {
+		t.Errorf("error expected for 2-byte payload")
+	}
+}
+
+// Test if encoding helpers round-trip through the corresponding accessors
+func TestEncodeDecode(t *testing.T) {
+	if v, err := (&Datagram{Data: EncodeFloat32(-1234.5)}).Float32(); err != nil || v != -1234.5 {
+		t.Errorf("error float32 got %f %v, should be -1234.5", v, err)
+	}
+	if v, err := (&Datagram{Data: EncodeUint16(0xBEEF)}).Uint16(); err != nil || v != 0xBEEF {
+		t.Errorf("error uint16 got %04X %v, should be BEEF", v, err)
+	}
+	if v, err := (&Datagram{Data: EncodeUint8(0x42)}).Uint8(); err != nil || v != 0x42 {
+		t.Errorf("error uint8 got %02X %v, should be 42", v, err)
+	}
+	if d := EncodeBool(true); len(d) != 1 || d[0] != 1 {
+		t.Errorf("error bool true got %v, should be [1]", d)
+	}
+	if d := EncodeBool(false); len(d) != 1 || d[0] != 0 {
+		t.Errorf("error bool false got %v, should be [0]", d)
+	}
+}
+
+// Test if Float32s decodes packed arrays and rejects lengths which are not a multiple of 4
+func TestDatagramFloat32s(t *testing.T) {
+	data := append(append(EncodeFloat32(1.5), EncodeFloat32(-2)...), EncodeFloat32(0)...)
+	vals, err := (&Datagram{Data: data}).Float32s()
+	if err != nil || len(vals) != 3 || vals[0] != 1.5 || vals[1] != -2 || vals[2] != 0 {
+		t.Errorf("error got %v %v, should be [1.5 -2 0]", vals, err)
+	}
+	if vals, err := (&Datagram{}).Float32s(); err != nil || len(vals) != 0 {
+		t.Errorf("error got %v %v for empty payload, should be []", vals, err)
+	}
+	if _, err := (&Datagram{Data: data[:6]}).Float32s(); err == nil {
+		t.Errorf("error expected for 6-byte payload")
+	}
+}
+
+// Test if Bool decodes single-byte payloads and rejects other lengths
+func TestDatagramBool(t *testing.T) {
+	if v, err := (&Datagram{Data: []byte{0x00}}).Bool(); err != nil || v {
+		t.Errorf("error got %v %v, should be false", v, err)
+	}
+	if v, err := (&Datagram{Data: []byte{0x01}}).Bool(); err != nil || !v {
+		t.Errorf("error got %v %v, should be true", v, err)
+	}
+	if _, err := (&Datagram{Data: []byte{0x00, 0x01}}).Bool(); err == nil {
+		t.Errorf("error 2-byte payload accepted")
+	}
+}
+
+// Test if Int16 sign-extends negative values
+func TestDatagramInt16(t *testing.T) {
+	cases := []struct {
+		Data   []byte
+		Expect int16
+	}{
+		{[]byte{0xFF, 0xFF}, -1},
+		{[]byte{0x80, 0x00}, -32768},
+		{[]byte{0xFF, 0x38}, -200},
+		{[]byte{0x7F, 0xFF}, 32767},
+		{[]byte{0x00, 0x00}, 0},
+	}
+	for _, tc := range cases {
+		v, err := (&Datagram{Response, BatteryTemperatureC, tc.Data}).Int16()
+		if err != nil || v != tc.Expect {
+			t.Errorf("error %v got %d %v, should be %d", tc.Data, v, err, tc.Expect)
+		}
+	}
+	if _, err := (&Datagram{Response, BatteryTemperatureC, []byte{0xFF}}).Int16(); err == nil {
+		t.Errorf("error expected for 1-byte payload")
+	}
+}
+
+// Test if SoC strategies convert to human-readable strings
+func TestSocStrategyString(t *testing.T) {
+	cases := map[SocStrategy]string{
+		SOCTargetSOC:           "SOC target",
+		SOCTargetConstant:      "Constant",
+		SOCTargetExternal:      "External",
+		SOCTargetMiddleVoltage: "Middle battery voltage",
+		SOCTargetInternal:      "Internal",
+		SOCTargetSchedule:      "Schedule",
+		SocStrategy(6):         "#INVALID",
+		SocStrategy(255):       "#INVALID",
+	}
+	for s, expect := range cases {
+		if res := s.String(); res != expect {
+			t.Errorf("error %d got %s, should be %s", uint8(s), res, expect)
+		}
+	}
+}
+
+// Test if battery status flags are listed by position
+func TestBatteryStatusString(t *testing.T) {
+	cases := map[BatteryStatus]string{
+		0:          "none",
+		1:          "bit 0",
+		0x0000000A: "bit 1, bit 3",
+		0x80000000: "bit 31",
+	}
+	for s, expect := range cases {
+		if res := s.String(); res != expect {
+			t.Errorf("error %08X got %s, should be %s", uint32(s), res, expect)
+		}
+	}
+}
+
+// Test if QueryTime returns timestamps in the location configured per connection
+func TestWithTimeLocation(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	srv := newMockServer(t, respondWith([]byte{0x60, 0xB6, 0x28, 0x9D}))
+	conn := newConnection(srv.Addr(), time.Minute, WithTimeLocation(loc))
+	defer conn.Close()
+
+	ts, err := conn.QueryTime(0x12345678)
+	if err != nil || ts.Location() != loc || ts.Unix() != 0x60B6289D {
+		t.Errorf("error got %v %v, should be %v in %v", ts, err, time.Unix(0x60B6289D, 0), loc)
+	}
+}
@@ -0,0 +1,86 @@
+package rct
+
+import (
+	"encoding/hex"
+)
+
+// Logger receiving structured log events from a connection, as key-value pairs following the message.
+// A *slog.Logger from the standard library satisfies this interface.
+type Logger interface {
+	Debug(msg string, keysAndValues ...interface{})
+	Info(msg string, keysAndValues ...interface{})
+	Error(msg string, keysAndValues ...interface{})
+}
+
+// Verbosity of log events passed to the logger
+type LogLevel int
+
+// Verbosity values, each including the ones before
+const (
+	LogLevelError LogLevel = iota // errors only
+	LogLevelInfo                  // errors and connection lifecycle events such as reconnects
+	LogLevelDebug                 // all of the above, and every datagram sent and received
+)
+
+// Returns a logger passing each event to all of the given loggers in order
+func MultiLogger(loggers ...Logger) Logger {
+	return multiLogger(loggers)
+}
+
+// Logger passing each event to several loggers
+type multiLogger []Logger
+
+// Passes a debug event to all loggers
+func (m multiLogger) Debug(msg string, keysAndValues ...interface{}) {
+	for _, l := range m {
+		l.Debug(msg, keysAndValues...)
+	}
+}
+
+// Passes a info event to all loggers
+func (m multiLogger) Info(msg string, keysAndValues ...interface{}) {
+	for _, l := range m {
+		l.Info(msg, keysAndValues...)
+	}
+}
+
+// Passes a error event to all loggers
+func (m multiLogger) Error(msg string, keysAndValues ...interface{}) {
+	for _, l := range m {
+		l.Error(msg, keysAndValues...)
+	}
+}
+
+// Logs an outgoing datagram at debug level, symmetric to logReceive. Frames not built from a datagram, such as
+// raw frames, are logged as escaped bytes instead.
+func (c *Connection) logSend(rdb *DatagramBuilder, dg *Datagram) {
+	if c.logger == nil || c.logLevel < LogLevelDebug {
+		return
+	}
+	if dg == nil {
+		c.logger.Debug("send", "host", c.host, "frame", hex.EncodeToString(rdb.Bytes()))
+		return
+	}
+	c.logger.Debug("send", "host", c.host, "cmd", dg.Cmd.String(), "id", dg.Id.String(), "data", hex.EncodeToString(dg.Data))
+}
+
+// Logs a received datagram at debug level
+func (c *Connection) logReceive(dg *Datagram) {
+	if c.logger != nil && c.logLevel >= LogLevelDebug {
+		c.logger.Debug("recv", "host", c.host, "cmd", dg.Cmd.String(), "id", dg.Id.String(), "data", hex.EncodeToString(dg.Data))
+	}
+}
+
+// Logs a connection lifecycle event at info level
+func (c *Connection) logInfo(msg string, keysAndValues ...interface{}) {
+	if c.logger != nil && c.logLevel >= LogLevelInfo {
+		c.logger.Info(msg, append([]interface{}{"host", c.host}, keysAndValues...)...)
+	}
+}
+
+// Logs an error at error level
+func (c *Connection) logError(msg string, err error, keysAndValues ...interface{}) {
+	if c.logger != nil {
+		c.logger.Error(msg, append([]interface{}{"host", c.host, "err", err}, keysAndValues...)...)
+	}
+}
@@ -0,0 +1,125 @@
+package rct
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// A logger recording all entries as strings, prefixed with their level
+type recordingLogger struct {
+	mu      sync.Mutex
+	entries []string
+}
+
+func (l *recordingLogger) record(level, msg string, keysAndValues []interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, fmt.Sprintf("%s %s %v", level, msg, keysAndValues))
+}
+
+func (l *recordingLogger) Debug(msg string, kv ...interface{}) { l.record("DEBUG", msg, kv) }
+func (l *recordingLogger) Info(msg string, kv ...interface{})  { l.record("INFO", msg, kv) }
+func (l *recordingLogger) Error(msg string, kv ...interface{}) { l.record("ERROR", msg, kv) }
+
+// Returns the recorded entries so far
+func (l *recordingLogger) Entries() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.entries...)
+}
+
+// Test if sends, receives and timeouts are logged with structured fields
+func TestWithLogger(t *testing.T) {
+	defer func(d time.Duration) { ReadTimeout = d }(ReadTimeout)
+	ReadTimeout = 50 * time.Millisecond
+
+	srv := newMockServer(t, func(req *Datagram) *Datagram {
+		if req.Id == BatteryPowerW {
+			return nil // never answer, causing a timeout
+		}
+		return &Datagram{Response, req.Id, EncodeFloat32(0.5)}
+	})
+	logger := &recordingLogger{}
+	conn, err := NewConnection(srv.Addr(), 0, WithLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Query(BatterySoC); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Query(BatteryPowerW); err == nil {
+		t.Fatal("error expected timeout")
+	}
+
+	expect := []string{
+		"DEBUG send [host " + srv.Addr() + " cmd Read id Battery state of charge data ]",
+		"DEBUG recv [host " + srv.Addr() + " cmd Response id Battery state of charge data 3f000000]",
+		"DEBUG send [host " + srv.Addr() + " cmd Read id Battery power [W] data ]",
+	}
+	entries := logger.Entries()
+	if len(entries) != len(expect)+1 {
+		t.Fatalf("error got %d entries %v, should be %d", len(entries), entries, len(expect)+1)
+	}
+	for i, e := range expect {
+		if entries[i] != e {
+			t.Errorf("error entry %d got %q, should be %q", i, entries[i], e)
+		}
+	}
+	if last := entries[len(entries)-1]; !strings.HasPrefix(last, "ERROR receive timed out") {
+		t.Errorf("error got %q, should be a timeout error", last)
+	}
+}
+
+// Test if events are filtered by log level, and passed to all loggers of a MultiLogger
+func TestWithLogLevel(t *testing.T) {
+	srv := newMockServer(t, respondWith(EncodeFloat32(0.5)))
+	expect := map[LogLevel][]string{
+		LogLevelError: {"ERROR"},
+		LogLevelInfo:  {"ERROR", "INFO"},
+		LogLevelDebug: {"ERROR", "INFO", "DEBUG", "DEBUG"},
+	}
+	for level, levels := range expect {
+		var dials int32
+		dialer := func(ctx context.Context, address string) (net.Conn, error) {
+			if atomic.AddInt32(&dials, 1) == 1 {
+				client, server := net.Pipe()
+				server.Close() // first transport is dead, causing an error and a reconnect
+				return client, nil
+			}
+			var d net.Dialer
+			return d.DialContext(ctx, "tcp", srv.Addr())
+		}
+		a, b := &recordingLogger{}, &recordingLogger{}
+		conn, err := NewConnection("inverter", 0, WithDialer(dialer), WithLogger(MultiLogger(a, b)), WithLogLevel(level))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := conn.Query(BatterySoC); err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+
+		for _, l := range []*recordingLogger{a, b} {
+			entries := l.Entries()
+			got := make([]string, len(entries))
+			for i, e := range entries {
+				got[i] = strings.SplitN(e, " ", 2)[0]
+			}
+			sort.Strings(got)
+			want := append([]string(nil), levels...)
+			sort.Strings(want)
+			if strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Errorf("error level %d got %v, should be %v", level, entries, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package rct
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoDevices is returned by aggregating queries of a manager without connections
+var ErrNoDevices = errors.New("no devices")
+
+// Manager of connections to several named RCT devices. The manager owns added connections: it closes them on Close,
+// and when replaced by Add, while Remove hands a connection back to the caller.
+type Manager struct {
+	mu    sync.RWMutex
+	conns map[string]*Connection
+}
+
+// Returns a new manager without connections
+func NewManager() *Manager {
+	return &Manager{conns: make(map[string]*Connection)}
+}
+
+// Adds the given connection under the given name, closing any previous connection of that name it replaces.
+// Connections shared with other code, such as those returned by NewConnection, should not be added.
+func (m *Manager) Add(name string, conn *Connection) {
+	m.mu.Lock()
+	prev := m.conns[name]
+	m.conns[name] = conn
+	m.mu.Unlock()
+	if prev != nil && prev != conn {
+		prev.Close()
+	}
+}
+
+// Connects to the RCT device at the given address and adds the connection under the given name. Unlike
+// NewConnection, the connection is never shared with other callers connecting to the same address, so closing it
+// via the manager does not affect them.
+func (m *Manager) Connect(name, host string, cache time.Duration, opts ...Option) error {
+	conn := newConnection(host, cache, opts...)
+	if err := conn.connect(); err != nil {
+		return fmt.Errorf("connecting %s: %w", name, err)
+	}
+	m.Add(name, conn)
+	return nil
+}
+
+// Returns the connection with the given name, or nil if unknown
+func (m *Manager) Get(name string) *Connection {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.conns[name]
+}
+
+// Removes the connection with the given name, without closing it. Returns the connection, or nil if unknown
+func (m *Manager) Remove(name string) *Connection {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	conn := m.conns[name]
+	delete(m.conns, name)
+	return conn
+}
+
+// Returns the names of all managed connections in sorted order
+func (m *Manager) Names() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	names := make([]string, 0, len(m.conns))
+	for name := range m.conns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Closes and removes all managed connections
+func (m *Manager) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name, conn := range m.conns {
+		conn.Close()
+		delete(m.conns, name)
+	}
+}
+
+// Errors of individual devices, by name
+type DeviceErrors map[string]error
+
+// Prints errors to string, in order of device names
+func (e DeviceErrors) Error() string {
+	names := make([]string, 0, len(e))
+	for name := range e {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	msgs := make([]string, len(names))
+	for i, name := range names {
+		msgs[i] = fmt.Sprintf("%s: %v", name, e[name])
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Warning returned alongside the partial result of an aggregating query, if some but not all devices failed
+type PartialError struct {
+	Succeeded int          // number of devices contributing to the result
+	Errs      DeviceErrors // errors of the failed devices, and of devices contributing stale values
+}
+
+// Prints error to string
+func (e PartialError) Error() string {
+	return fmt.Sprintf("partial result of %d devices: %v", e.Succeeded, e.Errs)
+}
+
+// Returns the errors of the individual devices
+func (e PartialError) Unwrap() error {
+	return e.Errs
+}
+
+// Returns true if the given error or any error it wraps is a PartialError, i.e. a partial result was returned
+func IsPartial(err error) bool {
+	var pe PartialError
+	return errors.As(err, &pe)
+}
+
+// Queries the given identifier on all devices concurrently, returning the datagrams of devices which succeeded.
+// Each device reconnects independently, so failures of one device don't affect the others. If any device failed,
+// the error is a DeviceErrors holding the error for each failed device.
+func (m *Manager) QueryAll(id Identifier) (map[string]*Datagram, error) {
+	var mu sync.Mutex
+	res := make(map[string]*Datagram)
+	errs := m.forEach(func(name string, conn *Connection) error {
+		dg, err := conn.Query(id)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		res[name] = dg
+		mu.Unlock()
+		return nil
+	})
+
+	if len(errs) > 0 {
+		return res, errs
+	}
+	return res, nil
+}
+
+// Queries the given float32 identifier on all devices concurrently, returning the sum over devices which succeeded,
+// e.g. for the total solar power of an installation. Last known values returned alongside a StaleError are summed
+// too, see WithStaleOnError. If some devices failed, the partial sum is returned with a PartialError as warning.
+// If all devices failed, the error is a DeviceErrors holding the error for each device, and ErrNoDevices if there are
+// no devices at all.
+func (m *Manager) SumFloat32(id Identifier) (float32, error) {
+	var mu sync.Mutex
+	sum, succeeded := float32(0), 0
+	errs := m.forEach(func(name string, conn *Connection) error {
+		v, err := conn.QueryFloat32(id)
+		if err != nil && !IsStale(err) {
+			return err
+		}
+		mu.Lock()
+		sum += v
+		succeeded++
+		mu.Unlock()
+		return err
+	})
+
+	switch {
+	case succeeded == 0 && len(errs) == 0:
+		return 0, ErrNoDevices
+	case succeeded == 0:
+		return 0, errs
+	case len(errs) > 0:
+		return sum, PartialError{succeeded, errs}
+	}
+	return sum, nil
+}
+
+// Calls the given function for all devices concurrently, returning the errors of devices for which it failed
+func (m *Manager) forEach(fn func(name string, conn *Connection) error) DeviceErrors {
+	m.mu.RLock()
+	conns := make(map[string]*Connection, len(m.conns))
+	for name, conn := range m.conns {
+		conns[name] = conn
+	}
+	m.mu.RUnlock()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	errs := make(DeviceErrors)
+	for name, conn := range conns {
+		wg.Add(1)
+		go func(name string, conn *Connection) {
+			defer wg.Done()
+			if err := fn(name, conn); err != nil {
+				mu.Lock()
+				errs[name] = err
+				mu.Unlock()
+			}
+		}(name, conn)
+	}
+	wg.Wait()
+	return errs
+}
+
+// Returns the sum of the connection health metrics across all managed connections
+func (m *Manager) Stats() (s Stats) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, conn := range m.conns {
+		cs := conn.Stats()
+		s.Received += cs.Received
+		s.ParseErrors += cs.ParseErrors
+		s.CRCErrors += cs.CRCErrors
+		s.Queries += cs.Queries
+		s.QueryTimeouts += cs.QueryTimeouts
+		s.CacheHits += cs.CacheHits
+		s.CacheMisses += cs.CacheMisses
+		s.Reconnects += cs.Reconnects
+		s.Retries += cs.Retries
+		s.BytesReceived += cs.BytesReceived
+	}
+	return s
+}
@@ -0,0 +1,197 @@
+package rct
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Test if the manager queries all devices, aggregating per-device errors and metrics
+func TestManagerQueryAll(t *testing.T) {
+	defer func(d time.Duration) { ReadTimeout = d }(ReadTimeout)
+	ReadTimeout = 50 * time.Millisecond
+
+	m := NewManager()
+	defer m.Close()
+	for name, v := range map[string]float32{"garage": 100, "roof": 200} {
+		srv := newMockServer(t, respondWith(EncodeFloat32(v)))
+		conn, err := NewConnection(srv.Addr(), time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.Add(name, conn)
+	}
+	silent := newMockServer(t, func(req *Datagram) *Datagram { return nil })
+	conn, err := NewConnection(silent.Addr(), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Add("shed", conn)
+
+	res, err := m.QueryAll(SolarGenAPowerW)
+	var errs DeviceErrors
+	if !errors.As(err, &errs) || len(errs) != 1 || !errors.Is(errs["shed"], ErrTimeout) {
+		t.Errorf("error got %v, should be a timeout for shed only", err)
+	}
+	if len(res) != 2 {
+		t.Fatalf("error got %d results, should be 2", len(res))
+	}
+	for name, expect := range map[string]float32{"garage": 100, "roof": 200} {
+		if v, err := res[name].Float32(); err != nil || v != expect {
+			t.Errorf("error %s got %f %v, should be %f", name, v, err, expect)
+		}
+	}
+	if s := m.Stats(); s.Queries != 3 || s.QueryTimeouts != 1 {
+		t.Errorf("error got %d queries %d timeouts, should be 3 and 1", s.Queries, s.QueryTimeouts)
+	}
+
+	if m.Remove("shed") != conn {
+		t.Errorf("error remove returned wrong connection")
+	}
+	conn.Close()
+	if _, err := m.QueryAll(SolarGenAPowerW); err != nil {
+		t.Errorf("error %v after removing failing device", err)
+	}
+}
+
+// Test if the manager connects devices by address and returns them by name
+func TestManagerConnect(t *testing.T) {
+	m := NewManager()
+	defer m.Close()
+	srv := newMockServer(t, respondWith(EncodeFloat32(0.5)))
+	if err := m.Connect("garage", srv.Addr(), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	conn := m.Get("garage")
+	if conn == nil {
+		t.Fatal("error connected device not found")
+	}
+	if v, err := conn.QueryFloat32(BatterySoC); err != nil || v != 0.5 {
+		t.Errorf("error got %f %v, should be 0.5", v, err)
+	}
+	if m.Get("roof") != nil {
+		t.Errorf("error unknown device found")
+	}
+
+	refuse := func(ctx context.Context, address string) (net.Conn, error) { return nil, errors.New("connection refused") }
+	if err := m.Connect("roof", "roof.invalid", time.Minute, WithDialer(refuse)); !errors.Is(err, ErrDisconnected) {
+		t.Errorf("error got %v, should be %v", err, ErrDisconnected)
+	}
+	if m.Get("roof") != nil {
+		t.Errorf("error failed device added")
+	}
+}
+
+// Test if managed connections are not shared with NewConnection, and replaced connections are closed
+func TestManagerOwnership(t *testing.T) {
+	srv := newMockServer(t, respondWith(EncodeFloat32(0.5)))
+	shared, err := NewConnection(srv.Addr(), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shared.Close()
+
+	m := NewManager()
+	if err := m.Connect("garage", srv.Addr(), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	replaced := m.Get("garage")
+	if replaced == shared {
+		t.Fatal("error managed connection shared with NewConnection")
+	}
+	if err := m.Connect("garage", srv.Addr(), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if replaced.isActive() || !m.Get("garage").isActive() {
+		t.Errorf("error replaced connection not closed, or replacement not connected")
+	}
+	m.Close()
+	if !shared.isActive() {
+		t.Errorf("error closing the manager closed a shared connection")
+	}
+	if _, err := shared.QueryFloat32(BatterySoC); err != nil {
+		t.Errorf("error %v querying shared connection", err)
+	}
+}
+
+// Test if float32 values are summed across devices, with a partial sum and warning if some devices fail,
+// and a hard error if all devices fail or there are none
+func TestManagerSumFloat32(t *testing.T) {
+	defer func(d time.Duration) { ReadTimeout = d }(ReadTimeout)
+	ReadTimeout = 50 * time.Millisecond
+
+	m := NewManager()
+	defer m.Close()
+	if _, err := m.SumFloat32(SolarGenAPowerW); !errors.Is(err, ErrNoDevices) {
+		t.Errorf("error got %v without devices, should be ErrNoDevices", err)
+	}
+
+	for name, v := range map[string]float32{"garage": 1500, "roof": 2500} {
+		srv := newMockServer(t, respondWith(EncodeFloat32(v)))
+		if err := m.Connect(name, srv.Addr(), time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if sum, err := m.SumFloat32(SolarGenAPowerW); err != nil || sum != 4000 {
+		t.Errorf("error got %f %v, should be 4000", sum, err)
+	}
+
+	silent := newMockServer(t, func(req *Datagram) *Datagram { return nil })
+	if err := m.Connect("shed", silent.Addr(), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	sum, err := m.SumFloat32(SolarGenBPowerW)
+	var pe PartialError
+	if !errors.As(err, &pe) || pe.Succeeded != 2 || len(pe.Errs) != 1 || pe.Errs["shed"] == nil {
+		t.Errorf("error got %v, should be a partial error for shed only", err)
+	}
+	if sum != 4000 {
+		t.Errorf("error got partial sum %f, should be 4000", sum)
+	}
+
+	failing := NewManager()
+	defer failing.Close()
+	if err := failing.Connect("shed", silent.Addr(), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	var errs DeviceErrors
+	if _, err := failing.SumFloat32(SolarGenBPowerW); IsPartial(err) || !errors.As(err, &errs) || len(errs) != 1 {
+		t.Errorf("error got %v with all devices failing, should be a hard error", err)
+	}
+}
+
+// Test if last known values returned alongside a StaleError are included in the sum
+func TestManagerSumFloat32Stale(t *testing.T) {
+	defer func(d time.Duration) { ReadTimeout = d }(ReadTimeout)
+	ReadTimeout = 50 * time.Millisecond
+
+	var mu sync.Mutex
+	answer := true
+	srv := newMockServer(t, func(req *Datagram) *Datagram {
+		mu.Lock()
+		defer mu.Unlock()
+		if !answer {
+			return nil
+		}
+		return &Datagram{Response, req.Id, EncodeFloat32(1500)}
+	})
+	m := NewManager()
+	defer m.Close()
+	if err := m.Connect("garage", srv.Addr(), 0, WithStaleOnError(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if sum, err := m.SumFloat32(SolarGenAPowerW); err != nil || sum != 1500 {
+		t.Fatalf("error got %f %v, should be 1500", sum, err)
+	}
+	mu.Lock()
+	answer = false
+	mu.Unlock()
+	sum, err := m.SumFloat32(SolarGenAPowerW)
+	var pe PartialError
+	if !errors.As(err, &pe) || pe.Succeeded != 1 || !IsStale(pe.Errs["garage"]) || sum != 1500 {
+		t.Errorf("error got %f %v, should be stale 1500 as partial result", sum, err)
+	}
+}
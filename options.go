@@ -0,0 +1,184 @@
+package rct
+
+import (
+	"context"
+	"io"
+	"math"
+	"net"
+	"time"
+)
+
+// Option to configure a connection, see NewConnection
+type Option func(*Connection)
+
+// Uses the given timeout for connecting to the device, instead of the package default DialTimeout
+func WithDialTimeout(timeout time.Duration) Option {
+	return func(c *Connection) {
+		c.dialTimeout = timeout
+	}
+}
+
+// Uses the given function to establish the transport to the device, instead of a plain TCP connection.
+// It is called with the device address and a context bounded by the dial timeout, also on reconnects.
+func WithDialer(dialer func(ctx context.Context, address string) (net.Conn, error)) Option {
+	return func(c *Connection) {
+		c.dialer = dialer
+	}
+}
+
+// Logs sends, receives, parse errors, timeouts and reconnects to the given structured logger, e.g. a *slog.Logger
+// The logger is invoked while the connection is locked, and must not call back into the connection.
+func WithLogger(logger Logger) Option {
+	return func(c *Connection) {
+		c.logger = logger
+	}
+}
+
+// Passes only log events up to the given verbosity to the logger, e.g. LogLevelInfo to omit per-datagram events.
+// Defaults to LogLevelDebug. Use MultiLogger to log to several destinations.
+func WithLogLevel(level LogLevel) Option {
+	return func(c *Connection) {
+		c.logLevel = level
+	}
+}
+
+// Calls the given function for errors while receiving, i.e. timeouts and disconnects, as well as for malformed
+// frames and CRC mismatches. The latter are passed as RecoverableError including the offending raw bytes.
+// The callback is invoked while the connection is locked, and must not call back into the connection.
+func WithErrorCallback(callback func(err error)) Option {
+	return func(c *Connection) {
+		c.onError = callback
+	}
+}
+
+// Calls the given function with the raw bytes the parser skipped to resynchronize on a valid frame, e.g. noise or
+// frames with a CRC mismatch. The callback is invoked while the connection is locked, and must not call back into
+// the connection.
+func WithResyncCallback(callback func(discarded []byte)) Option {
+	return func(c *Connection) {
+		c.onResync = callback
+	}
+}
+
+// Writes all bytes received from the device to the given writer before parsing, e.g. to capture traffic to a file
+// for later analysis with NewConnectionFromReader. Write errors are logged, and do not affect the connection.
+func WithCapture(w io.Writer) Option {
+	return func(c *Connection) {
+		c.capture = w
+	}
+}
+
+// Answers queries which time out with the last value received for the identifier, of any age, alongside a StaleError
+// wrapping ErrTimeout, like WithStaleOnError does for values of bounded age. Queries without any previous value still
+// fail. Late responses to timed out queries are always discarded, regardless of this option.
+func WithServeStaleOnTimeout(enable bool) Option {
+	return func(c *Connection) {
+		c.serveStale = enable
+	}
+}
+
+// Answers queries failing to reach the device with the last value received for the identifier, if it is at most
+// the given age, alongside a StaleError wrapping the failure. Query and QueryFloat32 return both, e.g. for dashboards
+// which prefer showing the last known value; other typed queries return only the error. Disabled if not positive.
+// Takes precedence over WithServeStaleOnTimeout if both are set, so timeouts also serve values up to maxStale only.
+func WithStaleOnError(maxStale time.Duration) Option {
+	return func(c *Connection) {
+		c.maxStale = maxStale
+	}
+}
+
+// Returns timestamps queried with QueryTime in the given location instead of the package-wide TimeLocation, e.g. for
+// devices in different time zones
+func WithTimeLocation(loc *time.Location) Option {
+	return func(c *Connection) {
+		c.timeLoc = loc
+	}
+}
+
+// Sets the maximum power in W accepted by setters such as SetSocChargePower and ForceCharge, e.g. to the rated power
+// of the installed inverter and battery. Defaults to MaxPowerW.
+func WithMaxPowerW(maxPowerW uint16) Option {
+	return func(c *Connection) {
+		c.maxPowerW = maxPowerW
+	}
+}
+
+// Drops received datagrams identical in command, identifier and payload to the previous one within the given
+// window, e.g. frames echoed by a proxy, before checking they answer the pending request. Responses for the
+// identifier of the pending request are kept, as a repeated query may legitimately receive the same value again.
+// Disabled if not positive.
+func WithDedup(window time.Duration) Option {
+	return func(c *Connection) {
+		c.dedupWindow = window
+	}
+}
+
+// Delays outgoing frames so that at least the given interval passes between them, pacing bursts of queries which
+// would otherwise overwhelm the device. Callers block while waiting, with the connection locked.
+func WithMinSendInterval(interval time.Duration) Option {
+	return func(c *Connection) {
+		c.minSendInterval = interval
+	}
+}
+
+// Closes the transport to the device after the given duration without sends or receives, e.g. to avoid silently
+// half-open sockets when NAT or firewall idle timers expire. It is re-established transparently on next use.
+func WithIdleTimeout(timeout time.Duration) Option {
+	return func(c *Connection) {
+		c.idleTimeout = timeout
+	}
+}
+
+// Retries failed reconnects for up to maxElapsed, waiting initial before the second attempt and doubling the delay
+// up to max for each further one. By default, a reconnect is attempted only once. The connection stays locked while
+// retrying, so concurrent queries wait for the outcome.
+func WithReconnectBackoff(initial, max, maxElapsed time.Duration) Option {
+	return func(c *Connection) {
+		c.backoffInitial, c.backoffMax, c.backoffMaxElapsed = initial, max, maxElapsed
+	}
+}
+
+// Receives into a buffer of the given size in bytes instead of DefaultParserBufferSize, e.g. for LongResponse
+// datagrams with large payloads. Frames exceeding the buffer are rejected as parse errors, never truncated.
+func WithBufferSize(n int) Option {
+	return func(c *Connection) {
+		c.parser = NewDatagramParserSize(n)
+	}
+}
+
+// Computes checksums with the given CRC polynomial and initial value instead of DefaultCRCPoly and DefaultCRCInit,
+// for devices using a protocol variant
+func WithCRC(poly, init uint16) Option {
+	return func(c *Connection) {
+		c.crcPoly, c.crcInit = poly, init
+	}
+}
+
+// Uses the given clock for cache expiry, value age and reconnect backoff instead of the system time, e.g. for
+// deterministic tests. Socket deadlines and the idle timeout always use the system time.
+func WithClock(clock Clock) Option {
+	return func(c *Connection) {
+		c.clock = clock
+		c.cache.clock = clock
+	}
+}
+
+// Validates float32 values returned by QueryFloat32 with the given function, which returns false for implausible values
+func WithValueValidator(validator func(id Identifier, v float32) bool) Option {
+	return func(c *Connection) {
+		c.validator = validator
+	}
+}
+
+// Default value validator, rejecting NaN and infinite values, and state of charge values outside 0 ... 1
+func DefaultValueValidator(id Identifier, v float32) bool {
+	f := float64(v)
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return false
+	}
+	switch id {
+	case BatterySoC, BatterySoCTarget, BatterySoCTargetHigh, BatterySoCTargetMin, BatterySoCTargetMinIsland, PowerMngSocTargetSet:
+		return v >= 0 && v <= 1
+	}
+	return true
+}
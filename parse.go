@@ -20,48 +20,116 @@ const (
 	AwaitingCrc0
 	AwaitingCrc1
 	Done
+	AwaitingLen1 // second length byte of LongWrite and LongResponse datagrams
 )
 
+// Default size of the parser buffer, which limits the size of a single transmission
+const DefaultParserBufferSize = 1024
+
 // A parser for RCT datagrams
 type DatagramParser struct {
-	buffer []byte
-	length int
-	pos    int
-	state  ParserState
+	buffer    []byte
+	length    int
+	pos       int
+	state     ParserState
+	crcErrors int        // number of frames discarded due to CRC mismatch in the last parse
+	mismatch  ParseError // CRC details of the last discarded frame, if crcErrors is positive
+	start     int        // offset of the start byte of the last frame, i.e. the number of bytes discarded before it
+	end       int        // offset after the last frame if parsed successfully, i.e. of any bytes following it
+	crcPoly   uint16
+	crcInit   uint16
+}
+
+// Error of a failed parse, describing where and why the transmission held no valid frame. It is recoverable,
+// i.e. wraps a RecoverableError
+type ParseError struct {
+	State       ParserState // state the parser ended in
+	Start       int         // offset of the start byte of the last frame in Raw
+	CRCMismatch bool        // whether a frame was discarded due to a CRC mismatch
+	CRCReceived uint16      // CRC transmitted with the last discarded frame, if any
+	CRCComputed uint16      // CRC computed for the last discarded frame, if any
+	Raw         []byte      // the parsed transmission
 }
 
-// Returns a new datagram parser
+// Prints error to string
+func (e ParseError) Error() string {
+	msg := fmt.Sprintf("parsing failed in state %d at frame offset %d of %d bytes", e.State, e.Start, len(e.Raw))
+	if e.CRCMismatch {
+		msg += fmt.Sprintf(", CRC mismatch received %04X computed %04X", e.CRCReceived, e.CRCComputed)
+	}
+	return msg
+}
+
+// Returns the error as RecoverableError, so IsRecoverable and errors.As recognize parse errors
+func (e ParseError) Unwrap() error {
+	return RecoverableError{e.Error()}
+}
+
+// Returns a new datagram parser with the default buffer size
 func NewDatagramParser() (p *DatagramParser) {
+	return NewDatagramParserSize(DefaultParserBufferSize)
+}
+
+// Returns a new datagram parser with the given buffer size in bytes. Use a larger buffer to receive
+// LongResponse datagrams with payloads beyond the default size.
+func NewDatagramParserSize(n int) (p *DatagramParser) {
 	return &DatagramParser{
-		buffer: make([]byte, 1024), // default buffer size
-		length: 0,
-		pos:    0,
-		state:  AwaitingStart,
+		buffer:  make([]byte, n),
+		length:  0,
+		pos:     0,
+		state:   AwaitingStart,
+		crcPoly: DefaultCRCPoly,
+		crcInit: DefaultCRCInit,
 	}
 }
 
 // Resets the state, without reallocating the buffer
 func (p *DatagramParser) Reset() {
-	p.length, p.pos, p.state = 0, 0, AwaitingStart
+	p.length, p.pos, p.state, p.crcErrors, p.start, p.end = 0, 0, AwaitingStart, 0, 0, 0
+}
+
+// Resets the state, retaining any bytes following the last successfully parsed frame at the start of the buffer,
+// as a single read may contain the next frame as well. Discards all bytes if the last parse failed.
+func (p *DatagramParser) compact() {
+	if p.state != Done {
+		p.Reset()
+		return
+	}
+	n := copy(p.buffer, p.buffer[p.end:p.length])
+	p.Reset()
+	p.length = n
 }
 
-// Parses a given transmission into a datagram
+// Returns true if the last parse ended within a frame, and the buffer has room for the remainder
+func (p *DatagramParser) partial() bool {
+	return p.state != AwaitingStart && p.state != Done && p.length < len(p.buffer)
+}
+
+// Parses a given transmission into a datagram. A transmission ending within a frame returns a ParseError with the
+// state the frame was cut off in, after which more bytes may be appended and parsed again.
 func (p *DatagramParser) Parse() (dg *Datagram, err error) {
-	length := uint8(0)
-	dataLength := uint8(0)
-	crc := CRC{}
+	length := 0
+	dataLength := 0
+	crc := CRC{poly: p.crcPoly, init: p.crcInit}
 	crcReceived := uint16(0)
+	var perr ParseError
 	escaped := false
 	state := AwaitingStart
 	dg = &Datagram{}
+	p.crcErrors = 0
 
 	//fmt.Printf("Parser ")
-	for _, b := range p.buffer[p.pos : p.length-p.pos] {
+	start, end := 0, 0
+	for i, b := range p.buffer[p.pos : p.length-p.pos] {
 		//fmt.Printf("(%v)-%02x->", state, b)
+		if state == Done {
+			break // ignore extra bytes
+		}
 
 		if !escaped {
 			if b == 0x2b {
 				state = AwaitingCmd
+				start = i
 				continue
 			} else if b == 0x2d {
 				escaped = true
@@ -90,7 +158,25 @@ func (p *DatagramParser) Parse() (dg *Datagram, err error) {
 
 		case AwaitingLen:
 			crc.Update(b)
-			length = uint8(b)
+			length = int(b)
+			if dg.Cmd == LongWrite || dg.Cmd == LongResponse {
+				state = AwaitingLen1 // two length bytes, high byte first
+				continue
+			}
+			if length < 4 || length-4 > len(p.buffer) {
+				state = AwaitingStart // framing error, length must cover the identifier; resync on next start byte
+				continue
+			}
+			dataLength = length - 4
+			state = AwaitingId0
+
+		case AwaitingLen1:
+			crc.Update(b)
+			length = length<<8 | int(b)
+			if length < 4 || length-4 > len(p.buffer) {
+				state = AwaitingStart // framing error, length must cover the identifier; resync on next start byte
+				continue
+			}
 			dataLength = length - 4
 			state = AwaitingId0
 
@@ -123,7 +209,7 @@ func (p *DatagramParser) Parse() (dg *Datagram, err error) {
 		case AwaitingData:
 			crc.Update(b)
 			dg.Data = append(dg.Data, b)
-			if len(dg.Data) >= int(dataLength) {
+			if len(dg.Data) >= dataLength {
 				state = AwaitingCrc0
 			}
 
@@ -136,19 +222,51 @@ func (p *DatagramParser) Parse() (dg *Datagram, err error) {
 			crcCalculated := crc.Get()
 			if crcCalculated != crcReceived {
 				// fmt.Printf("[CRC error calc %04x want %04x]", crcCalculated, crcReceived)
+				p.crcErrors++
+				perr.CRCMismatch, perr.CRCReceived, perr.CRCComputed = true, crcReceived, crcCalculated
 				state = AwaitingStart // CRCError
 			} else {
 				state = Done
+				end = i + 1
 			}
 
-		case Done:
-			// ignore extra bytes
 		}
 	}
 	//fmt.Printf("(%v)\n", state)
+	p.state = state
+	p.start = start
+	p.end = end
+	p.mismatch = perr
 
 	if state != Done {
-		return dg, RecoverableError{fmt.Sprintf("parsing failed in state %d", state)}
+		perr.State, perr.Start = state, start
+		perr.Raw = append([]byte(nil), p.buffer[p.pos:p.length]...)
+		return dg, perr
+	}
+	return dg, nil
+}
+
+// Decodes the first frame of the given transmission into a datagram, without a connection. Returns a
+// ParseError, which is recoverable, if it holds no valid frame, see VerifyFrame.
+func Decode(b []byte) (*Datagram, error) {
+	dg, err := VerifyFrame(b)
+	if err != nil {
+		return nil, err
 	}
 	return dg, nil
 }
+
+// Verifies a complete raw frame including start byte, escaping and CRC, as captured from the wire,
+// using the same logic as the parser. Returns the datagram, and a ParseError if the frame is invalid,
+// including if a frame with CRC mismatch preceded a valid one.
+func VerifyFrame(raw []byte) (*Datagram, error) {
+	p := NewDatagramParserSize(len(raw))
+	p.length = copy(p.buffer, raw)
+	dg, err := p.Parse()
+	if err == nil && p.crcErrors > 0 {
+		perr := p.mismatch
+		perr.State, perr.Start, perr.Raw = p.state, p.start, append([]byte(nil), raw...)
+		return dg, perr
+	}
+	return dg, err
+}
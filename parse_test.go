@@ -0,0 +1,242 @@
+package rct
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// Test if length bytes too small to cover the identifier are treated as framing errors
+func TestParserShortLength(t *testing.T) {
+	builder := NewDatagramBuilder()
+	parser := NewDatagramParser()
+	valid := Datagram{Response, BatterySoC, []byte{0x3f, 0x00, 0x00, 0x00}}
+	builder.Build(&valid)
+
+	for length := byte(0); length < 4; length++ {
+		bad := []byte{0x2b, byte(Response), length, 0x95, 0x99, 0x30, 0xbf, 0x12, 0x34}
+
+		parser.Reset()
+		parser.length = copy(parser.buffer, bad)
+		if _, err := parser.Parse(); err == nil {
+			t.Errorf("error length %d parsed without error", length)
+		}
+		if parser.state != AwaitingStart {
+			t.Errorf("error length %d left parser in state %d, should be %d", length, parser.state, AwaitingStart)
+		}
+
+		parser.Reset()
+		parser.length = copy(parser.buffer, append(bad, builder.Bytes()...))
+		dg, err := parser.Parse()
+		if err != nil {
+			t.Errorf("error length %d: %v", length, err)
+			continue
+		}
+		if dg.Cmd != valid.Cmd || dg.Id != valid.Id || string(dg.Data) != string(valid.Data) {
+			t.Errorf("error length %d got %s, should be %s", length, dg.String(), valid.String())
+		}
+	}
+}
+
+// Fuzz the parser with arbitrary transmissions, asserting it never panics and always returns a datagram
+func FuzzParse(f *testing.F) {
+	builder := NewDatagramBuilder()
+	for _, tc := range builderTestCases {
+		builder.Build(&tc.Dg)
+		f.Add(append([]byte(nil), builder.Bytes()...))
+	}
+	f.Add([]byte{0x2b, 0x05, 0x00, 0x95, 0x99, 0x30, 0xbf})                         // length underflow
+	f.Add([]byte{0x2b, 0x05, 0x08, 0x95, 0x99, 0x30, 0xbf, 0x3f})                   // truncated frame
+	f.Add([]byte{0x2b, 0x05, 0x08, 0x95, 0x99, 0x30, 0xbf, 0x3f, 0, 0, 0, 0, 0})    // CRC mismatch
+	f.Add([]byte{0x2b, 0x2d, 0x2d, 0x2b, 0x2b, 0x2d, 0xff, 0xff, 0xff, 0xff, 0xff}) // escape and start byte soup
+	f.Add([]byte{0x2b, 0x06, 0xff, 0xff, 0x95, 0x99, 0x30, 0xbf, 0x3f})             // long length beyond buffer
+	f.Add(longResponse(BatterySoC, make([]byte, 300)))                              // valid long frame
+
+	parser := NewDatagramParser()
+	f.Fuzz(func(t *testing.T, data []byte) {
+		parser.Reset()
+		parser.length = copy(parser.buffer, data)
+		dg, err := parser.Parse()
+		if dg == nil {
+			t.Fatalf("nil datagram for %v", data)
+		}
+		if err == nil && parser.state != Done {
+			t.Fatalf("success in state %d for %v", parser.state, data)
+		}
+		if err == nil && len(dg.Data) > maxDataLength(dg.Cmd) || len(dg.Data) > len(data) {
+			t.Fatalf("data length %d exceeds maximum for %v", len(dg.Data), data)
+		}
+	})
+}
+
+// Benchmark parsing a received transmission into a datagram
+func BenchmarkParse(b *testing.B) {
+	builder := NewDatagramBuilder()
+	builder.Build(&Datagram{Response, BatterySoC, []byte{0x3f, 0x00, 0x00, 0x00}})
+	parser := NewDatagramParser()
+	b.SetBytes(int64(len(builder.Bytes())))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		parser.Reset()
+		parser.length = copy(parser.buffer, builder.Bytes())
+		if _, err := parser.Parse(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Returns the transmission of a LongResponse datagram with two length bytes
+func longResponse(id Identifier, data []byte) []byte {
+	builder := NewDatagramBuilder()
+	builder.Build(&Datagram{LongResponse, id, data})
+	return append([]byte(nil), builder.Bytes()...)
+}
+
+// Test if compacting retains the bytes following a parsed frame, and discards the buffer after a failed parse
+func TestParserCompact(t *testing.T) {
+	builder := NewDatagramBuilder()
+	builder.Build(&Datagram{Response, BatterySoC, EncodeFloat32(0.5)})
+	first := append([]byte(nil), builder.Bytes()...)
+	builder.Build(&Datagram{Response, InverterACPowerW, EncodeFloat32(1500)})
+	second := append([]byte(nil), builder.Bytes()...)
+
+	parser := NewDatagramParser()
+	parser.length = copy(parser.buffer, append(first, second[:5]...))
+	if dg, err := parser.Parse(); err != nil || dg.Id != BatterySoC {
+		t.Fatalf("error got %v %v, should be %s", dg, err, BatterySoC.String())
+	}
+	parser.compact()
+	if !bytes.Equal(parser.buffer[:parser.length], second[:5]) {
+		t.Fatalf("error retained % X, should be % X", parser.buffer[:parser.length], second[:5])
+	}
+	if _, err := parser.Parse(); err == nil || !parser.partial() {
+		t.Errorf("error retained head parsed as complete=%v, should be partial", err == nil)
+	}
+	parser.length += copy(parser.buffer[parser.length:], second[5:])
+	if dg, err := parser.Parse(); err != nil || dg.Id != InverterACPowerW {
+		t.Errorf("error got %v %v, should be %s", dg, err, InverterACPowerW.String())
+	}
+
+	parser.Reset()
+	parser.length = copy(parser.buffer, first[:5])
+	parser.Parse()
+	parser.compact()
+	if parser.length != 0 {
+		t.Errorf("error retained %d bytes after failed parse, should be 0", parser.length)
+	}
+}
+
+// Test if LongResponse datagrams larger than the default buffer parse with a larger buffer, and are rejected otherwise
+func TestParserLongResponse(t *testing.T) {
+	data := make([]byte, 1500)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	frame := longResponse(BatterySoC, data)
+
+	parser := NewDatagramParserSize(4096)
+	parser.length = copy(parser.buffer, frame)
+	dg, err := parser.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dg.Cmd != LongResponse || dg.Id != BatterySoC || string(dg.Data) != string(data) {
+		t.Errorf("error got %v %08X with %d bytes, should be LongResponse %08X with %d bytes", dg.Cmd, uint32(dg.Id), len(dg.Data), uint32(BatterySoC), len(data))
+	}
+
+	parser = NewDatagramParser()
+	parser.length = copy(parser.buffer, frame)
+	if _, err := parser.Parse(); err == nil {
+		t.Errorf("error oversized frame parsed from truncated buffer")
+	}
+}
+
+// Test if two-byte lengths of long datagrams too small to cover the identifier are treated as framing errors
+func TestParserShortLongLength(t *testing.T) {
+	builder := NewDatagramBuilder()
+	valid := Datagram{Response, BatterySoC, []byte{0x3f, 0x00, 0x00, 0x00}}
+	builder.Build(&valid)
+
+	parser := NewDatagramParser()
+	for length := 0; length < 4; length++ {
+		bad := []byte{0x2b, byte(LongResponse), 0x00, byte(length), 0x95, 0x99, 0x30, 0xbf, 0x12, 0x34}
+		parser.Reset()
+		parser.length = copy(parser.buffer, append(bad, builder.Bytes()...))
+		dg, err := parser.Parse()
+		if err != nil || dg.Cmd != valid.Cmd || dg.Id != valid.Id {
+			t.Errorf("error length %d got %v %v, should resync to %s", length, dg, err, valid.String())
+		}
+	}
+}
+
+// Test if the length byte counts unescaped payload bytes, so frames with escaped payload bytes end exactly at
+// their CRC, and are incomplete while any wire byte is missing
+func TestParserEscapedData(t *testing.T) {
+	builder := NewDatagramBuilder()
+	parser := NewDatagramParser()
+	for _, data := range [][]byte{
+		{0x2b},
+		{0x2d, 0x2d},
+		{0x00, 0x2b, 0x2d, 0x00},
+		bytes.Repeat([]byte{0x2b}, 100),
+		{0x3f, 0x00, 0x00, 0x2d}, // escape as last payload byte before the CRC
+	} {
+		dg := Datagram{Response, BatterySoC, data}
+		builder.Build(&dg)
+		frame := append([]byte(nil), builder.Bytes()...)
+		if len(frame) <= len(data)+9 {
+			t.Errorf("error frame % X for % X has no escape bytes", frame, data)
+		}
+
+		// trailing bytes of a following frame must not be taken as payload
+		builder.Build(&Datagram{Response, InverterACPowerW, EncodeFloat32(1)})
+		parser.Reset()
+		parser.length = copy(parser.buffer, append(frame, builder.Bytes()...))
+		parsed, err := parser.Parse()
+		if err != nil || parsed.Id != dg.Id || !bytes.Equal(parsed.Data, data) {
+			t.Errorf("error got %v %v, should be %s", parsed, err, dg.String())
+		}
+
+		for n := 1; n < len(frame); n++ {
+			parser.Reset()
+			parser.length = copy(parser.buffer, frame[:n])
+			if _, err := parser.Parse(); err == nil || !parser.partial() {
+				t.Errorf("error truncated frame % X parsed as complete=%v, should be partial", frame[:n], err == nil)
+				break
+			}
+		}
+	}
+}
+
+// Test if parse errors describe CRC mismatches, truncated frames and bad command bytes, and are recoverable
+func TestParseError(t *testing.T) {
+	valid := Encode(&Datagram{Response, BatterySoC, EncodeFloat32(0.5)})
+	crc := ComputeCRC(Response, BatterySoC, EncodeFloat32(0.5))
+	corrupt := append(append([]byte(nil), valid[:len(valid)-2]...), 0x12, 0x34)
+
+	for _, tc := range []struct {
+		raw      []byte
+		state    ParserState
+		start    int
+		mismatch bool
+	}{
+		{corrupt, AwaitingStart, 0, true},
+		{valid[:6], AwaitingId3, 0, false},
+		{append([]byte{0x00, 0x2b, 0xff}, valid[1:4]...), AwaitingStart, 1, false},
+	} {
+		parser := NewDatagramParser()
+		parser.length = copy(parser.buffer, tc.raw)
+		_, err := parser.Parse()
+		var pe ParseError
+		if !errors.As(err, &pe) || !IsRecoverable(err) {
+			t.Errorf("error got %T %v for % X, should be recoverable ParseError", err, err, tc.raw)
+			continue
+		}
+		if pe.State != tc.state || pe.Start != tc.start || pe.CRCMismatch != tc.mismatch || !bytes.Equal(pe.Raw, tc.raw) {
+			t.Errorf("error got %+v for % X, should be state %d start %d mismatch %v", pe, tc.raw, tc.state, tc.start, tc.mismatch)
+		}
+		if tc.mismatch && (pe.CRCReceived != 0x1234 || pe.CRCComputed != crc) {
+			t.Errorf("error got CRC received %04X computed %04X, should be 1234 and %04X", pe.CRCReceived, pe.CRCComputed, crc)
+		}
+	}
+}
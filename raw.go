@@ -0,0 +1,70 @@
+package rct
+
+import (
+	"net"
+	"sync"
+)
+
+// Returns framed raw access to the device, bypassing the cache and higher-level methods, e.g. to explore
+// undocumented identifiers with hand-crafted frames. Each write sends the given bytes verbatim as one frame,
+// including start byte, escaping and CRC. Each read waits up to ReadTimeout for the next valid frame and returns
+// it as built by a DatagramBuilder. Closing the raw access leaves the connection open.
+func (c *Connection) Raw() *RawConn {
+	return &RawConn{c: c}
+}
+
+// Framed raw access to a device, see Connection.Raw. Implements io.ReadWriteCloser
+type RawConn struct {
+	c       *Connection
+	mu      sync.Mutex // guards pending and closed
+	pending []byte     // remainder of the last received frame not yet read
+	closed  bool
+}
+
+// Reads the next received frame, or the remainder of the last one if it did not fit into the given buffer
+func (r *RawConn) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return 0, net.ErrClosed
+	}
+	if len(r.pending) == 0 {
+		dg, err := r.c.Receive()
+		if err != nil {
+			return 0, err
+		}
+		builder := newDatagramBuilderCRC(r.c.crcPoly, r.c.crcInit)
+		builder.Build(dg)
+		r.pending = builder.Bytes()
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// Sends the given bytes as one frame, reconnecting if required
+func (r *RawConn) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	closed := r.closed
+	r.mu.Unlock()
+	if closed {
+		return 0, net.ErrClosed
+	}
+
+	c := r.c
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	builder := c.getBuilder()
+	defer c.putBuilder(builder)
+	builder.buffer.Write(p)
+	return c.send(builder, nil)
+}
+
+// Ends raw access, without closing the connection
+func (r *RawConn) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	r.pending = nil
+	return nil
+}
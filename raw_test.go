@@ -0,0 +1,49 @@
+package rct
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+// Test if raw frames are sent verbatim, and received frames are read whole or in pieces
+func TestRaw(t *testing.T) {
+	regs := &mockRegisters{values: map[Identifier][]byte{BatterySoC: EncodeFloat32(0.5)}}
+	srv := newMockServer(t, regs.handle)
+	conn, err := NewConnection(srv.Addr(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var raw io.ReadWriteCloser = conn.Raw()
+	builder := NewDatagramBuilder()
+	builder.Build(&Datagram{Read, BatterySoC, nil})
+	if n, err := raw.Write(builder.Bytes()); err != nil || n != len(builder.Bytes()) {
+		t.Fatalf("error got %d %v writing, should be %d", n, err, len(builder.Bytes()))
+	}
+
+	builder.Build(&Datagram{Response, BatterySoC, EncodeFloat32(0.5)})
+	want := append([]byte(nil), builder.Bytes()...)
+	head := make([]byte, 3)
+	if n, err := raw.Read(head); err != nil || n != 3 {
+		t.Fatalf("error got %d %v reading, should be 3", n, err)
+	}
+	rest := make([]byte, 64)
+	n, err := raw.Read(rest)
+	if err != nil || !bytes.Equal(append(head, rest[:n]...), want) {
+		t.Errorf("error got % X %v, should be % X", append(head, rest[:n]...), err, want)
+	}
+
+	if err := raw.Close(); err != nil {
+		t.Error(err)
+	}
+	if _, err := raw.Write(want); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("error got %v writing after close, should be %v", err, net.ErrClosed)
+	}
+	if v, err := conn.QueryFloat32(BatterySoC); err != nil || v != 0.5 {
+		t.Errorf("error got %f %v querying after raw close, should be 0.5", v, err)
+	}
+}
@@ -0,0 +1,117 @@
+package rct
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// A value read from the RCT device, scaled and with unit for presentation
+type Reading struct {
+	Id    Identifier
+	Raw   float64 // value as transmitted by the device
+	Value float64 // value scaled into the unit
+	Unit  string
+}
+
+// Converts a reading into a human-readable representation
+func (r Reading) String() string {
+	if r.Unit == "" {
+		return fmt.Sprintf("%s = %g", r.Id.String(), r.Value)
+	}
+	return fmt.Sprintf("%s = %g %s", r.Id.String(), r.Value, r.Unit)
+}
+
+// Prints a RCT datagram like String, followed by its decoded value and unit if the identifier is known,
+// e.g. for log output. Enumerated values are printed by name.
+func (d *Datagram) DetailedString() string {
+	var v fmt.Stringer
+	switch d.Id {
+	case InverterState:
+		if b, err := d.Uint8(); err == nil {
+			v = InverterStates(b)
+		}
+	case PowerMngSocStrategy:
+		if b, err := d.Uint8(); err == nil {
+			v = SocStrategy(b)
+		}
+	}
+	if v != nil {
+		return fmt.Sprintf("%s = %s", d.String(), v)
+	}
+
+	reg, ok := LookupRegister(d.Id)
+	if !ok {
+		return d.String()
+	}
+	switch reg.Kind {
+	case KindTime:
+		if t, err := d.Time(); err == nil {
+			return fmt.Sprintf("%s = %s", d.String(), t.Format(time.RFC3339))
+		}
+	case KindString:
+		return fmt.Sprintf("%s = %q", d.String(), strings.TrimRight(string(d.Data), "\x00"))
+	default:
+		if r, err := d.Reading(); err == nil {
+			if r.Unit == "" {
+				return fmt.Sprintf("%s = %g", d.String(), r.Value)
+			}
+			return fmt.Sprintf("%s = %g %s", d.String(), r.Value, r.Unit)
+		}
+	}
+	return d.String()
+}
+
+// Returns the datagram body value as a reading, scaled according to the register metadata of its identifier
+func (d *Datagram) Reading() (r Reading, err error) {
+	reg, ok := LookupRegister(d.Id)
+	if !ok {
+		return Reading{}, fmt.Errorf("unknown identifier %08X", uint32(d.Id))
+	}
+	raw, err := d.number(reg.Kind)
+	if err != nil {
+		return Reading{}, err
+	}
+	scale := reg.Scale
+	if scale == 0 {
+		scale = 1
+	}
+	return Reading{d.Id, raw, raw * scale, reg.Unit}, nil
+}
+
+// Returns the datagram body value as a number, decoding it according to the given kind
+func (d *Datagram) number(kind ValueKind) (val float64, err error) {
+	switch kind {
+	case KindFloat32:
+		v, err := d.Float32()
+		return float64(v), err
+	case KindUint8:
+		v, err := d.Uint8()
+		return float64(v), err
+	case KindUint16:
+		v, err := d.Uint16()
+		return float64(v), err
+	case KindUint32:
+		v, err := d.Uint32()
+		return float64(v), err
+	case KindInt16:
+		v, err := d.Int16()
+		return float64(v), err
+	case KindBool:
+		v, err := d.Bool()
+		if v {
+			return 1, err
+		}
+		return 0, err
+	}
+	return 0, fmt.Errorf("identifier %08X of kind %s has no numeric value", uint32(d.Id), kind)
+}
+
+// Queries the given identifier on the RCT device, returning its value as a reading scaled for presentation
+func (c *Connection) QueryReading(id Identifier) (r Reading, err error) {
+	dg, err := c.Query(id)
+	if err != nil {
+		return Reading{}, err
+	}
+	return dg.Reading()
+}
@@ -0,0 +1,68 @@
+package rct
+
+import (
+	"testing"
+	"time"
+)
+
+// Test if readings apply the scale and unit of their identifier
+func TestQueryReading(t *testing.T) {
+	values := map[Identifier][]byte{
+		BatterySoC:      EncodeFloat32(0.5),
+		TotalEnergyWh:   EncodeFloat32(12345),
+		SolarGenAPowerW: EncodeFloat32(1234.5),
+		InverterState:   {byte(StateFeedIn)},
+	}
+	srv := newMockServer(t, func(req *Datagram) *Datagram {
+		return &Datagram{Response, req.Id, values[req.Id]}
+	})
+	conn, err := NewConnection(srv.Addr(), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	cases := []Reading{
+		{BatterySoC, 0.5, 50, "%"},
+		{TotalEnergyWh, 12345, 12.345, "kWh"},
+		{SolarGenAPowerW, 1234.5, 1234.5, "W"},
+		{InverterState, 13, 13, ""},
+	}
+	for _, expect := range cases {
+		r, err := conn.QueryReading(expect.Id)
+		if err != nil {
+			t.Errorf("error %s: %v", expect.Id, err)
+			continue
+		}
+		if r.Id != expect.Id || r.Raw != expect.Raw || r.Unit != expect.Unit || r.Value-expect.Value > 1e-9 || expect.Value-r.Value > 1e-9 {
+			t.Errorf("error got %+v, should be %+v", r, expect)
+		}
+	}
+
+	if _, err := (&Datagram{Response, 0x12345678, EncodeFloat32(1)}).Reading(); err == nil {
+		t.Errorf("error expected for unknown identifier")
+	}
+	if s := (Reading{BatterySoC, 0.5, 50, "%"}).String(); s != "Battery state of charge = 50 %" {
+		t.Errorf("error got %q", s)
+	}
+}
+
+// Test if detailed strings append the decoded value and unit for known identifiers, and names for enumerations
+func TestDatagramDetailedString(t *testing.T) {
+	cases := []struct {
+		Dg     Datagram
+		Expect string
+	}{
+		{Datagram{Response, SolarGenAPowerW, EncodeFloat32(1234.5)}, " = 1234.5 W"},
+		{Datagram{Response, BatterySoC, EncodeFloat32(0.5)}, " = 50 %"},
+		{Datagram{Response, InverterState, EncodeUint8(uint8(StateFeedIn))}, " = Feed in"},
+		{Datagram{Response, PowerMngSocStrategy, EncodeUint8(uint8(SOCTargetInternal))}, " = Internal"},
+		{Datagram{Response, 0x12345678, EncodeFloat32(1)}, ""},
+		{Datagram{Response, SolarGenAPowerW, []byte{1}}, ""}, // invalid payload
+	}
+	for _, tc := range cases {
+		if s := tc.Dg.DetailedString(); s != tc.Dg.String()+tc.Expect {
+			t.Errorf("error got %q, should be %q", s, tc.Dg.String()+tc.Expect)
+		}
+	}
+}
@@ -1,5 +1,11 @@
 package rct
 
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
 // Errors caused by a malformed or unexpected packet, which can be potentially be recovered by retrying the transmission
 type RecoverableError struct {
 	Err string
@@ -9,3 +15,32 @@ type RecoverableError struct {
 func (e RecoverableError) Error() string {
 	return e.Err
 }
+
+// Returns true if the given error or any error it wraps is a RecoverableError, e.g. to decide whether to retry
+func IsRecoverable(err error) bool {
+	var re RecoverableError
+	var pre *RecoverableError
+	return errors.As(err, &re) || errors.As(err, &pre)
+}
+
+// Error returned alongside the last known value of a query which failed, see WithStaleOnError
+type StaleError struct {
+	Age time.Duration // age of the returned value
+	Err error         // error of the failed query
+}
+
+// Prints error to string
+func (e StaleError) Error() string {
+	return fmt.Sprintf("stale value of age %v: %v", e.Age, e.Err)
+}
+
+// Returns the error of the failed query
+func (e StaleError) Unwrap() error {
+	return e.Err
+}
+
+// Returns true if the given error or any error it wraps is a StaleError, i.e. a last known value was returned
+func IsStale(err error) bool {
+	var se StaleError
+	return errors.As(err, &se)
+}
@@ -0,0 +1,32 @@
+package rct
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// Test if recoverable errors are detected bare, by pointer and wrapped
+func TestIsRecoverable(t *testing.T) {
+	re := RecoverableError{"invalid response"}
+	cases := []struct {
+		Err    error
+		Expect bool
+	}{
+		{re, true},
+		{&re, true},
+		{fmt.Errorf("querying: %w", re), true},
+		{fmt.Errorf("outer: %w", fmt.Errorf("inner: %w", &re)), true},
+		{&WriteTransactionError{Index: 0, Err: re}, true},
+		{fmt.Errorf("querying: %v", re), false}, // not wrapped
+		{ErrTimeout, false},
+		{ValidationError{"out of range"}, false},
+		{nil, false},
+		{errors.New("other"), false},
+	}
+	for i, tc := range cases {
+		if res := IsRecoverable(tc.Err); res != tc.Expect {
+			t.Errorf("error case %d %v got %v, should be %v", i, tc.Err, res, tc.Expect)
+		}
+	}
+}
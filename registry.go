@@ -0,0 +1,309 @@
+package rct
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Kind of value held by an identifier on the RCT device
+type ValueKind uint8
+
+// Kinds of values held by identifiers on the RCT device
+const (
+	KindUnknown ValueKind = iota
+	KindFloat32
+	KindUint8
+	KindUint16
+	KindUint32
+	KindInt16
+	KindBool
+	KindTime // uint32 seconds since the Unix epoch; no built-in identifier is known to hold one, see RegisterIdentifier
+	KindString
+)
+
+// Table to convert value kinds to human-readable strings, as used in register definitions
+var valueKindToString = []string{
+	"unknown",
+	"float32",
+	"uint8",
+	"uint16",
+	"uint32",
+	"int16",
+	"bool",
+	"time",
+	"string",
+}
+
+// Converts a value kind to a human-readable representation
+func (k ValueKind) String() string {
+	if int(k) >= len(valueKindToString) {
+		return "#INVALID"
+	}
+	return valueKindToString[k]
+}
+
+// Parses a value kind from its human-readable representation
+func ParseValueKind(s string) (ValueKind, error) {
+	for i, name := range valueKindToString {
+		if name == s {
+			return ValueKind(i), nil
+		}
+	}
+	return KindUnknown, fmt.Errorf("unknown value kind %q", s)
+}
+
+// Metadata of an identifier on the RCT device
+type Register struct {
+	Id    Identifier
+	Name  string
+	Kind  ValueKind
+	Unit  string
+	Scale float64 // factor converting the raw value into the unit, 0 is treated as 1
+}
+
+// Value kind, unit and scale of an identifier. The name is kept in identifiersToString
+type registerInfo struct {
+	kind  ValueKind
+	unit  string
+	scale float64
+}
+
+var (
+	// Guards identifiersToString and identifierInfo, which can be extended at runtime
+	registryMu sync.RWMutex
+
+	// Table of value kinds and units for known identifiers
+	identifierInfo = map[Identifier]registerInfo{
+		// power
+		//
+		SolarGenAPowerW:  {KindFloat32, "W", 1},
+		SolarGenBPowerW:  {KindFloat32, "W", 1},
+		BatteryPowerW:    {KindFloat32, "W", 1},
+		InverterACPowerW: {KindFloat32, "W", 1},
+		RealPowerW:       {KindFloat32, "W", 1},
+		TotalGridPowerW:  {KindFloat32, "W", 1},
+		BatterySoC:       {KindFloat32, "%", 100},
+		S0ExternalPowerW: {KindFloat32, "W", 1},
+
+		// voltage
+		//
+		SolarGenAVoltage: {KindFloat32, "V", 1},
+		SolarGenBVoltage: {KindFloat32, "V", 1},
+		BatteryVoltage:   {KindFloat32, "V", 1},
+
+		// energy
+		//
+		TotalEnergyWh:           {KindFloat32, "kWh", 0.001},
+		TotalEnergySolarGenAWh:  {KindFloat32, "kWh", 0.001},
+		TotalEnergySolarGenBWh:  {KindFloat32, "kWh", 0.001},
+		TotalEnergyBattInWh:     {KindFloat32, "kWh", 0.001},
+		TotalEnergyBattOutWh:    {KindFloat32, "kWh", 0.001},
+		TotalEnergyHouseholdWh:  {KindFloat32, "kWh", 0.001},
+		TotalEnergyGridWh:       {KindFloat32, "kWh", 0.001},
+		TotalEnergyGridFeedInWh: {KindFloat32, "kWh", 0.001},
+		TotalEnergyGridLoadWh:   {KindFloat32, "kWh", 0.001},
+
+		// other
+		//
+		InverterState:             {KindUint8, "", 1},
+		BatteryCapacityAh:         {KindFloat32, "Ah", 1},
+		BatteryTemperatureC:       {KindFloat32, "°C", 1},
+		BatterySoCTarget:          {KindFloat32, "%", 100},
+		BatterySoCTargetHigh:      {KindFloat32, "%", 100},
+		BatterySoCTargetMin:       {KindFloat32, "%", 100},
+		BatterySoCTargetMinIsland: {KindFloat32, "%", 100},
+		BatteryBatStatus:          {KindUint32, "", 1},
+
+		// power management
+		//
+		PowerMngSocStrategy:        {KindUint8, "", 1},
+		PowerMngSocTargetSet:       {KindFloat32, "%", 100},
+		PowerMngSocChargePowerW:    {KindFloat32, "W", 1},
+		PowerMngUseGridPowerEnable: {KindBool, "", 1},
+
+		// device information
+		//
+		DeviceName:            {KindString, "", 1},
+		DeviceSerialNumber:    {KindString, "", 1},
+		DeviceSoftwareVersion: {KindString, "", 1},
+	}
+)
+
+// Returns the metadata for the given identifier, if known
+func LookupRegister(id Identifier) (r Register, ok bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	name, ok := identifiersToString[id]
+	if !ok {
+		return Register{}, false
+	}
+	info := identifierInfo[id]
+	return Register{id, name, info.kind, info.unit, info.scale}, true
+}
+
+// Loads additional register definitions from the given JSON or CSV document, and merges them into the registry.
+//
+// JSON documents hold an array of objects like {"id": "0x959930BF", "name": "Battery state of charge", "type": "float32",
+// "unit": "%", "scale": 100}. CSV documents hold records with the same fields in the order id,name,type,unit,scale,
+// optionally preceded by a header line. Unit and scale may be omitted, keeping those of a known identifier or
+// defaulting to none and 1 otherwise. Definitions which are duplicate within the
+// document or conflict with a known identifier of different name or type are rejected, and nothing is merged.
+func LoadRegisters(r io.Reader) error {
+	br := bufio.NewReader(r)
+	var regs []Register
+	var err error
+	if isJSON(br) {
+		regs, err = decodeRegistersJSON(br)
+	} else {
+		regs, err = decodeRegistersCSV(br)
+	}
+	if err != nil {
+		return err
+	}
+	return mergeRegisters(regs)
+}
+
+// Adds the given identifier with name and value kind to the registry, so it is known to String, IdentifierByName,
+// LookupRegister and readings. Registering a known identifier again with the same name and kind has no effect,
+// while a different name or kind is rejected.
+func RegisterIdentifier(id Identifier, name string, kind ValueKind) error {
+	if name == "" {
+		return fmt.Errorf("missing name for identifier %08X", uint32(id))
+	}
+	return mergeRegisters([]Register{{id, name, kind, "", 0}})
+}
+
+// Returns the identifier with the given name, if known
+func IdentifierByName(name string) (id Identifier, ok bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	for id, n := range identifiersToString {
+		if n == name {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// Merges the given register definitions into the registry, rejecting all of them if any is duplicate or conflicting.
+// An empty unit or zero scale keeps the one of a known identifier, or defaults to none and 1 respectively.
+func mergeRegisters(regs []Register) error {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	seen := make(map[Identifier]bool, len(regs))
+	for _, reg := range regs {
+		if seen[reg.Id] {
+			return fmt.Errorf("duplicate definition for identifier %08X", uint32(reg.Id))
+		}
+		seen[reg.Id] = true
+		if name, ok := identifiersToString[reg.Id]; ok {
+			if info := identifierInfo[reg.Id]; name != reg.Name || info.kind != reg.Kind {
+				return fmt.Errorf("definition %q (%s) for identifier %08X conflicts with %q (%s)", reg.Name, reg.Kind, uint32(reg.Id), name, info.kind)
+			}
+		}
+	}
+	for _, reg := range regs {
+		info, known := identifierInfo[reg.Id]
+		if reg.Unit == "" && known {
+			reg.Unit = info.unit
+		}
+		if reg.Scale == 0 {
+			reg.Scale = 1
+			if known {
+				reg.Scale = info.scale
+			}
+		}
+		identifiersToString[reg.Id] = reg.Name
+		identifierInfo[reg.Id] = registerInfo{reg.Kind, reg.Unit, reg.Scale}
+	}
+	return nil
+}
+
+// Returns whether the buffered document is JSON, judging by its first non-whitespace character
+func isJSON(br *bufio.Reader) bool {
+	head, _ := br.Peek(512)
+	head = bytes.TrimLeft(head, " \t\r\n")
+	return len(head) > 0 && head[0] == '['
+}
+
+// Register definition as represented in JSON documents
+type registerJSON struct {
+	Id    string  `json:"id"`
+	Name  string  `json:"name"`
+	Type  string  `json:"type"`
+	Unit  string  `json:"unit"`
+	Scale float64 `json:"scale"`
+}
+
+// Decodes register definitions from a JSON document
+func decodeRegistersJSON(r io.Reader) ([]Register, error) {
+	var defs []registerJSON
+	if err := json.NewDecoder(r).Decode(&defs); err != nil {
+		return nil, err
+	}
+	regs := make([]Register, len(defs))
+	for i, d := range defs {
+		reg, err := newRegister(d.Id, d.Name, d.Type, d.Unit, d.Scale)
+		if err != nil {
+			return nil, fmt.Errorf("register %d: %v", i, err)
+		}
+		regs[i] = reg
+	}
+	return regs, nil
+}
+
+// Decodes register definitions from a CSV document
+func decodeRegistersCSV(r io.Reader) ([]Register, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) > 0 && len(records[0]) > 0 && strings.EqualFold(records[0][0], "id") {
+		records = records[1:] // skip header
+	}
+	regs := make([]Register, len(records))
+	for i, rec := range records {
+		if len(rec) < 3 || len(rec) > 5 {
+			return nil, fmt.Errorf("line %d: expected 3 to 5 fields, got %d", i+1, len(rec))
+		}
+		unit, scale := "", 0.0
+		if len(rec) > 3 {
+			unit = rec[3]
+		}
+		if len(rec) > 4 && rec[4] != "" {
+			if scale, err = strconv.ParseFloat(rec[4], 64); err != nil {
+				return nil, fmt.Errorf("line %d: %v", i+1, err)
+			}
+		}
+		if regs[i], err = newRegister(rec[0], rec[1], rec[2], unit, scale); err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+	}
+	return regs, nil
+}
+
+// Validates the fields of a register definition and returns the register
+func newRegister(id, name, kind, unit string, scale float64) (Register, error) {
+	i, err := strconv.ParseUint(strings.TrimSpace(id), 0, 32)
+	if err != nil {
+		return Register{}, fmt.Errorf("invalid identifier %q", id)
+	}
+	if name == "" {
+		return Register{}, fmt.Errorf("missing name for identifier %q", id)
+	}
+	k, err := ParseValueKind(kind)
+	if err != nil {
+		return Register{}, err
+	}
+	return Register{Identifier(i), name, k, unit, scale}, nil // zero scale is defaulted when merging
+}
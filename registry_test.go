@@ -0,0 +1,113 @@
+package rct
+
+import (
+	"strings"
+	"testing"
+)
+
+// Test if register definitions loaded from JSON and CSV are merged into the registry
+func TestLoadRegisters(t *testing.T) {
+	defer func() {
+		registryMu.Lock()
+		for _, id := range []Identifier{0x1AC87AA0, 0x5E0A1B2C, 0x6F1B2C3D} {
+			delete(identifiersToString, id)
+			delete(identifierInfo, id)
+		}
+		registryMu.Unlock()
+	}()
+
+	json := `[
+		{"id": "0x1AC87AA0", "name": "House power [W]", "type": "float32", "unit": "W"},
+		{"id": "0x959930BF", "name": "Battery state of charge", "type": "float32"}
+	]`
+	if err := LoadRegisters(strings.NewReader(json)); err != nil {
+		t.Fatal(err)
+	}
+	csv := "id,name,type,unit,scale\n0x5E0A1B2C,Test label,string\n0x6F1B2C3D,Test serial number,string,,\n"
+	if err := LoadRegisters(strings.NewReader(csv)); err != nil {
+		t.Fatal(err)
+	}
+
+	for id, expect := range map[Identifier]string{
+		0x1AC87AA0: "House power [W]",
+		0x5E0A1B2C: "Test label",
+		0x6F1B2C3D: "Test serial number",
+		BatterySoC: "Battery state of charge",
+	} {
+		if res := id.String(); res != expect {
+			t.Errorf("error %08X got %s, should be %s", uint32(id), res, expect)
+		}
+	}
+	if reg, ok := LookupRegister(0x1AC87AA0); !ok || reg.Kind != KindFloat32 || reg.Unit != "W" || reg.Scale != 1 {
+		t.Errorf("error got %+v, should be float32 in W with scale 1", reg)
+	}
+	// redefining a known identifier without unit and scale keeps its own
+	if reg, ok := LookupRegister(BatterySoC); !ok || reg.Unit != "%" || reg.Scale != 100 {
+		t.Errorf("error got %+v, should keep %% with scale 100", reg)
+	}
+	if r, err := (&Datagram{Response, BatterySoC, EncodeFloat32(0.5)}).Reading(); err != nil || r.Value != 50 {
+		t.Errorf("error got %v %v, should be 50", r, err)
+	}
+}
+
+// Test if duplicate and conflicting register definitions are rejected without merging
+func TestLoadRegistersConflict(t *testing.T) {
+	cases := []string{
+		`[{"id": "0x959930BF", "name": "Something else", "type": "float32"}]`,
+		`[{"id": "0x959930BF", "name": "Battery state of charge", "type": "uint8"}]`,
+		"0x1AC87AA0,House power,float32\n0x1AC87AA0,House power,float32\n",
+		"0x1AC87AA0,House power,complex128\n",
+		"not-an-id,House power,float32\n",
+	}
+	for _, doc := range cases {
+		if err := LoadRegisters(strings.NewReader(doc)); err == nil {
+			t.Errorf("error no error for %q", doc)
+		}
+	}
+	if _, ok := LookupRegister(0x1AC87AA0); ok {
+		t.Errorf("error rejected definition was merged")
+	}
+}
+
+// Test if identifiers registered at runtime are known to name lookup, printing and readings
+func TestRegisterIdentifier(t *testing.T) {
+	id := Identifier(0x1AC87AA0)
+	defer func() {
+		registryMu.Lock()
+		delete(identifiersToString, id)
+		delete(identifierInfo, id)
+		registryMu.Unlock()
+	}()
+
+	if _, ok := IdentifierByName("House power [W]"); ok {
+		t.Fatalf("error identifier known before registration")
+	}
+	if err := RegisterIdentifier(id, "House power [W]", KindFloat32); err != nil {
+		t.Fatal(err)
+	}
+	if res, ok := IdentifierByName("House power [W]"); !ok || res != id {
+		t.Errorf("error got %08X %v, should be %08X", uint32(res), ok, uint32(id))
+	}
+	if s := id.String(); s != "House power [W]" {
+		t.Errorf("error got %q", s)
+	}
+	if r, err := (&Datagram{Response, id, EncodeFloat32(800)}).Reading(); err != nil || r.Value != 800 {
+		t.Errorf("error got %v %v, should be 800", r, err)
+	}
+
+	if err := RegisterIdentifier(id, "House power [W]", KindFloat32); err != nil {
+		t.Errorf("error %v registering the same identifier again", err)
+	}
+	if err := RegisterIdentifier(id, "House power [W]", KindUint16); err == nil {
+		t.Errorf("error conflicting kind accepted")
+	}
+	if err := RegisterIdentifier(BatterySoC, "Battery state of charge", KindFloat32); err != nil {
+		t.Errorf("error %v re-registering built-in identifier", err)
+	}
+	if r, _ := LookupRegister(BatterySoC); r.Scale != 100 {
+		t.Errorf("error got scale %v, should keep 100", r.Scale)
+	}
+	if id, ok := IdentifierByName("Battery state of charge"); !ok || id != BatterySoC {
+		t.Errorf("error built-in identifier not found by name")
+	}
+}
@@ -0,0 +1,76 @@
+package rct
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"time"
+)
+
+// Creates a connection which receives the raw bytes from the given reader instead of a device, e.g. to replay a
+// captured transmission through parsing, caching and queries. Each query consumes the next frame from the reader,
+// outgoing datagrams are discarded. Once the reader is exhausted, queries fail with ErrDisconnected.
+// The connection is not shared with NewConnection, and the dialer option is ignored.
+func NewConnectionFromReader(r io.Reader, cache time.Duration, opts ...Option) (*Connection, error) {
+	conn := newConnection("replay", cache, opts...)
+	replay := &replayConn{r: bufio.NewReader(r)}
+	conn.dialer = func(ctx context.Context, address string) (net.Conn, error) {
+		if replay.done {
+			return nil, errors.New("replay finished")
+		}
+		replay.done = true
+		return replay, nil
+	}
+	if err := conn.connect(); err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Transport replaying frames from a reader, and discarding writes
+type replayConn struct {
+	r    *bufio.Reader
+	done bool // whether the transport was handed out already
+}
+
+// Reads the next frame, i.e. up to but excluding the next unescaped start byte, as a device would send it
+func (c *replayConn) Read(p []byte) (n int, err error) {
+	escaped := false
+	for n < len(p) {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, err
+		}
+		if n > 0 && !escaped && b == 0x2b {
+			c.r.UnreadByte()
+			break
+		}
+		escaped = !escaped && b == 0x2d
+		p[n] = b
+		n++
+	}
+	return n, nil
+}
+
+// Discards the given bytes
+func (c *replayConn) Write(p []byte) (n int, err error) {
+	return len(p), nil
+}
+
+func (c *replayConn) Close() error                       { return nil }
+func (c *replayConn) LocalAddr() net.Addr                { return replayAddr{} }
+func (c *replayConn) RemoteAddr() net.Addr               { return replayAddr{} }
+func (c *replayConn) SetDeadline(t time.Time) error      { return nil }
+func (c *replayConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *replayConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// Address of a replayed transport
+type replayAddr struct{}
+
+func (replayAddr) Network() string { return "replay" }
+func (replayAddr) String() string  { return "replay" }
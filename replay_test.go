@@ -0,0 +1,117 @@
+package rct
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+// Test if a captured transmission is replayed frame by frame through parsing, caching and queries
+func TestNewConnectionFromReader(t *testing.T) {
+	builder := NewDatagramBuilder()
+	builder.Build(&Datagram{Response, BatterySoC, EncodeFloat32(0.5)})
+	soc := hex.EncodeToString(builder.Bytes())
+	builder.Build(&Datagram{Response, BatteryPowerW, EncodeFloat32(-1500)})
+	power := hex.EncodeToString(builder.Bytes())
+	corrupt := power[:len(power)-2] + "00"
+	capture, err := hex.DecodeString("001337" + soc + corrupt + power)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var errs []error
+	conn, err := NewConnectionFromReader(bytes.NewReader(capture), 0, WithErrorCallback(func(err error) { errs = append(errs, err) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Query(BatterySoC); err == nil {
+		t.Errorf("error leading junk parsed")
+	}
+	if v, err := conn.QueryFloat32(BatterySoC); err != nil || v != 0.5 {
+		t.Errorf("error got %f %v, should be 0.5", v, err)
+	}
+	if _, err := conn.Query(BatteryPowerW); err == nil {
+		t.Errorf("error corrupt frame parsed")
+	}
+	if v, err := conn.QueryFloat32(BatteryPowerW); err != nil || v != -1500 {
+		t.Errorf("error got %f %v, should be -1500", v, err)
+	}
+	if _, err := conn.Query(BatterySoCTarget); !errors.Is(err, ErrDisconnected) {
+		t.Errorf("error got %v, should be %v at end of capture", err, ErrDisconnected)
+	}
+	if len(errs) != 3 {
+		t.Errorf("error got %d callbacks %v, should be 3", len(errs), errs)
+	}
+}
+
+// Writer which always fails
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) { return 0, errors.New("disk full") }
+
+// Test if captured traffic replays to the same values, and capture failures do not affect the connection
+func TestWithCapture(t *testing.T) {
+	values := map[Identifier]float32{BatterySoC: 0.5, BatteryPowerW: -1500}
+	srv := newMockServer(t, func(req *Datagram) *Datagram {
+		return &Datagram{Response, req.Id, EncodeFloat32(values[req.Id])}
+	})
+	var capture bytes.Buffer
+	conn, err := NewConnection(srv.Addr(), 0, WithCapture(&capture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []Identifier{BatterySoC, BatteryPowerW} {
+		if _, err := conn.Query(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	conn.Close()
+
+	replay, err := NewConnectionFromReader(&capture, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replay.Close()
+	for _, id := range []Identifier{BatterySoC, BatteryPowerW} {
+		if v, err := replay.QueryFloat32(id); err != nil || v != values[id] {
+			t.Errorf("error replay of %s got %f %v, should be %f", id, v, err, values[id])
+		}
+	}
+
+	conn, err = NewConnection(srv.Addr(), 0, WithCapture(failingWriter{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if v, err := conn.QueryFloat32(BatterySoC); err != nil || v != 0.5 {
+		t.Errorf("error got %f %v with failing capture, should be 0.5", v, err)
+	}
+}
+
+// Fuzz queries on replayed transmissions, asserting they never panic and always terminate with a result or an error
+func FuzzReplay(f *testing.F) {
+	builder := NewDatagramBuilder()
+	for _, tc := range builderTestCases {
+		builder.Build(&tc.Dg)
+		f.Add(append([]byte(nil), builder.Bytes()...))
+	}
+	f.Add(longResponse(BatterySoC, make([]byte, 300)))
+	f.Add([]byte{0x00, 0x2b, 0x05, 0x08, 0x95, 0x99, 0x30, 0xbf, 0x3f, 0x2b, 0x2b, 0x2d})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		conn, err := NewConnectionFromReader(bytes.NewReader(data), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		for i := 0; i <= len(data); i++ { // each query consumes at least one byte, or fails at the end
+			if _, err := conn.Query(BatterySoC); errors.Is(err, ErrDisconnected) {
+				return
+			}
+		}
+		t.Fatalf("replay of %d bytes did not terminate", len(data))
+	})
+}
@@ -0,0 +1,263 @@
+// Package serial adapts serial ports, e.g. RS-485 adapters, into transports for RCT device connections.
+//
+// Any port implementing io.ReadWriteCloser can be used, such as those opened with go.bug.st/serial, which keeps this
+// package free of dependencies:
+//
+//	dialer := serial.Dialer(func(address string) (io.ReadWriteCloser, error) {
+//		return goserial.Open(address, &goserial.Mode{BaudRate: 115200})
+//	})
+//	conn, err := rct.NewConnection("/dev/ttyUSB0", time.Minute, rct.WithDialer(dialer))
+package serial
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Returns a dialer for rct.WithDialer, which opens the serial port named by the connection host with the given
+// function. The TCP port number the connection appends to the host is stripped.
+func Dialer(open func(device string) (io.ReadWriteCloser, error)) func(ctx context.Context, address string) (net.Conn, error) {
+	return func(ctx context.Context, address string) (net.Conn, error) {
+		if host, _, err := net.SplitHostPort(address); err == nil {
+			address = host
+		}
+		port, err := open(address)
+		if err != nil {
+			return nil, err
+		}
+		return NewConn(port, address), nil
+	}
+}
+
+// A net.Conn over a serial port. Reads and writes honor deadlines, and changing a deadline affects pending calls.
+type Conn struct {
+	port    io.ReadWriteCloser
+	name    string
+	chunks  chan []byte      // data read from the port
+	err     error            // error which ended reading from the port, valid once chunks is closed
+	writes  chan []byte      // data to write to the port
+	written chan writeResult // results of writes to the port
+	closed  chan struct{}    // closed by Close
+
+	readMu        sync.Mutex // serializes reads, guards pending
+	pending       []byte     // data read from the port but not yet returned
+	writeMu       sync.Mutex // serializes writes, guards writing
+	writing       bool       // whether the result of a write which timed out is still outstanding
+	readDeadline  *deadline
+	writeDeadline *deadline
+	closeOnce     sync.Once
+}
+
+// Result of a write to the port
+type writeResult struct {
+	n   int
+	err error
+}
+
+// Returns a connection over the given serial port, with the given name as address
+func NewConn(port io.ReadWriteCloser, name string) *Conn {
+	c := &Conn{
+		port:          port,
+		name:          name,
+		chunks:        make(chan []byte),
+		writes:        make(chan []byte),
+		written:       make(chan writeResult),
+		closed:        make(chan struct{}),
+		readDeadline:  newDeadline(),
+		writeDeadline: newDeadline(),
+	}
+	go c.pump()
+	go c.writer()
+	return c
+}
+
+// Reads from the port until it fails or the connection is closed, as port reads cannot be interrupted by deadlines
+func (c *Conn) pump() {
+	defer close(c.chunks)
+	for {
+		buf := make([]byte, 256)
+		n, err := c.port.Read(buf)
+		if n > 0 {
+			select {
+			case c.chunks <- buf[:n]:
+			case <-c.closed:
+				return
+			}
+		}
+		if err != nil {
+			c.err = err
+			return
+		}
+	}
+}
+
+// Writes to the port until the connection is closed, as port writes cannot be interrupted by deadlines either
+func (c *Conn) writer() {
+	for {
+		select {
+		case p := <-c.writes:
+			n, err := c.port.Write(p)
+			select {
+			case c.written <- writeResult{n, err}:
+			case <-c.closed:
+				return
+			}
+		case <-c.closed:
+			return
+		}
+	}
+}
+
+// Reads data from the port, waiting until data arrives, the read deadline expires or the connection is closed
+func (c *Conn) Read(p []byte) (int, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	for len(c.pending) == 0 {
+		timeout, changed, stop := c.readDeadline.wait()
+		select {
+		case chunk, ok := <-c.chunks:
+			stop()
+			if !ok {
+				return 0, c.err
+			}
+			c.pending = chunk
+		case <-timeout:
+			return 0, os.ErrDeadlineExceeded
+		case <-changed:
+			stop() // wait again for the new deadline
+		case <-c.closed:
+			stop()
+			return 0, net.ErrClosed
+		}
+	}
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// Writes data to the port, waiting until it is written, the write deadline expires or the connection is closed.
+// A write which timed out may still complete later, so the next write waits for it first.
+func (c *Conn) Write(p []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.writing {
+		if _, err := c.awaitWrite(); err != nil {
+			return 0, err
+		}
+	}
+	select {
+	case c.writes <- append([]byte(nil), p...): // copied, as the caller may reuse p once a write timed out
+		c.writing = true
+	case <-c.closed:
+		return 0, net.ErrClosed
+	}
+	return c.awaitWrite()
+}
+
+// Waits for the result of the outstanding write, the write deadline or the connection to close
+func (c *Conn) awaitWrite() (int, error) {
+	for {
+		timeout, changed, stop := c.writeDeadline.wait()
+		select {
+		case res := <-c.written:
+			stop()
+			c.writing = false
+			return res.n, res.err
+		case <-timeout:
+			return 0, os.ErrDeadlineExceeded
+		case <-changed:
+			stop() // wait again for the new deadline
+		case <-c.closed:
+			stop()
+			return 0, net.ErrClosed
+		}
+	}
+}
+
+// Closes the connection and the port
+func (c *Conn) Close() (err error) {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		err = c.port.Close()
+	})
+	return err
+}
+
+// Returns the address of the serial port
+func (c *Conn) LocalAddr() net.Addr {
+	return Addr(c.name)
+}
+
+// Returns the address of the serial port
+func (c *Conn) RemoteAddr() net.Addr {
+	return Addr(c.name)
+}
+
+// Sets the read and write deadlines
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	c.writeDeadline.set(t)
+	return nil
+}
+
+// Sets the read deadline, also for a pending read
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	return nil
+}
+
+// Sets the write deadline, also for a pending write
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline.set(t)
+	return nil
+}
+
+// A deadline which pending operations wait on, and which can be changed while they do
+type deadline struct {
+	mu      sync.Mutex
+	t       time.Time
+	changed chan struct{} // closed and replaced when t changes
+}
+
+// Returns a new deadline which never expires
+func newDeadline() *deadline {
+	return &deadline{changed: make(chan struct{})}
+}
+
+// Sets the deadline, waking up operations waiting on the previous one
+func (d *deadline) set(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.t = t
+	close(d.changed)
+	d.changed = make(chan struct{})
+}
+
+// Returns channels receiving when the deadline expires, which is nil if there is none, and when it changes,
+// as well as a function to release the timer once done waiting
+func (d *deadline) wait() (timeout <-chan time.Time, changed <-chan struct{}, stop func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.t.IsZero() {
+		return nil, d.changed, func() {}
+	}
+	timer := time.NewTimer(time.Until(d.t))
+	return timer.C, d.changed, func() { timer.Stop() }
+}
+
+// Address of a serial port, i.e. its device name
+type Addr string
+
+// Returns the network name
+func (a Addr) Network() string {
+	return "serial"
+}
+
+// Returns the device name
+func (a Addr) String() string {
+	return string(a)
+}
@@ -0,0 +1,94 @@
+//go:build linux
+// +build linux
+
+package serial
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"testing"
+	"unsafe"
+
+	"github.com/mlnoga/rct"
+)
+
+// Opens a pseudo terminal in raw mode, returning its master as the device end and its slave as the serial port
+func openPty(t *testing.T) (device, port *os.File) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Skipf("no pseudo terminals: %v", err)
+	}
+	var n, unlock uint32
+	if err := ioctl(master, syscall.TIOCSPTLCK, unsafe.Pointer(&unlock)); err != nil {
+		master.Close()
+		t.Skipf("unlocking pseudo terminal: %v", err)
+	}
+	if err := ioctl(master, syscall.TIOCGPTN, unsafe.Pointer(&n)); err != nil {
+		master.Close()
+		t.Skipf("naming pseudo terminal: %v", err)
+	}
+	slave, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		t.Skipf("opening pseudo terminal: %v", err)
+	}
+
+	// raw mode, as the line discipline would otherwise echo and translate bytes of the binary protocol
+	var tio syscall.Termios
+	if err := ioctl(slave, syscall.TCGETS, unsafe.Pointer(&tio)); err != nil {
+		t.Fatal(err)
+	}
+	tio.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	tio.Oflag &^= syscall.OPOST
+	tio.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	tio.Cflag = tio.Cflag&^(syscall.CSIZE|syscall.PARENB) | syscall.CS8
+	tio.Cc[syscall.VMIN], tio.Cc[syscall.VTIME] = 1, 0
+	if err := ioctl(slave, syscall.TCSETS, unsafe.Pointer(&tio)); err != nil {
+		t.Fatal(err)
+	}
+	return master, slave
+}
+
+// Issues the given ioctl request on the given file
+func ioctl(f *os.File, req uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), req, uintptr(arg)); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// Test if a connection queries a device over a pseudo terminal, as a stand-in for a serial adapter
+func TestDialerQueryPty(t *testing.T) {
+	device, port := openPty(t)
+	defer device.Close()
+	dialer := Dialer(func(name string) (io.ReadWriteCloser, error) {
+		return port, nil
+	})
+
+	go func() { // answers every request with a SoC of 50%
+		builder := rct.NewDatagramBuilder()
+		buf := make([]byte, 64)
+		for {
+			if _, err := device.Read(buf); err != nil {
+				return
+			}
+			builder.Build(&rct.Datagram{Cmd: rct.Response, Id: rct.BatterySoC, Data: []byte{0x3f, 0x00, 0x00, 0x00}})
+			if _, err := device.Write(builder.Bytes()); err != nil {
+				return
+			}
+		}
+	}()
+
+	conn, err := rct.NewConnection("/dev/ttyPTY", 0, rct.WithDialer(dialer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for i := 0; i < 3; i++ {
+		if soc, err := conn.QueryFloat32(rct.BatterySoC); err != nil || soc != 0.5 {
+			t.Errorf("error got %v %v, should be 0.5", soc, err)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package serial
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mlnoga/rct"
+)
+
+// Loopback port, connecting the writes of one end to the reads of the other via pipes
+type pipePort struct {
+	*io.PipeReader
+	*io.PipeWriter
+}
+
+// Closes both pipes
+func (p pipePort) Close() error {
+	p.PipeReader.Close()
+	return p.PipeWriter.Close()
+}
+
+// Returns both ends of a loopback port
+func loopback() (host, device pipePort) {
+	hr, dw := io.Pipe()
+	dr, hw := io.Pipe()
+	return pipePort{hr, hw}, pipePort{dr, dw}
+}
+
+// Test if reads time out at the read deadline, and data written by the other end is read afterwards
+func TestConnReadDeadline(t *testing.T) {
+	host, device := loopback()
+	conn := NewConn(host, "/dev/ttyTEST")
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	buf := make([]byte, 16)
+	if _, err := conn.Read(buf); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("error got %v, should be deadline exceeded", err)
+	}
+
+	go device.Write([]byte{1, 2, 3})
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil || string(buf[:n]) != string([]byte{1, 2, 3}) {
+		t.Errorf("error got %v %v, should be [1 2 3]", buf[:n], err)
+	}
+	if conn.RemoteAddr().String() != "/dev/ttyTEST" || conn.RemoteAddr().Network() != "serial" {
+		t.Errorf("error got address %s %s", conn.RemoteAddr().Network(), conn.RemoteAddr().String())
+	}
+}
+
+// Test if setting the read deadline from another goroutine unblocks a pending read
+func TestConnSetReadDeadlineUnblocksRead(t *testing.T) {
+	host, _ := loopback()
+	conn := NewConn(host, "/dev/ttyTEST")
+	defer conn.Close()
+
+	done := make(chan error)
+	go func() {
+		_, err := conn.Read(make([]byte, 16))
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	conn.SetReadDeadline(time.Now())
+	select {
+	case err := <-done:
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Errorf("error got %v, should be deadline exceeded", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("error pending read not unblocked by new deadline")
+	}
+}
+
+// Test if writes to a stuck port time out at the write deadline, and later writes wait for the stuck one first
+func TestConnWriteDeadline(t *testing.T) {
+	host, device := loopback()
+	conn := NewConn(host, "/dev/ttyTEST")
+	defer conn.Close()
+
+	conn.SetWriteDeadline(time.Now().Add(20 * time.Millisecond))
+	if _, err := conn.Write([]byte{1, 2, 3}); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("error got %v, should be deadline exceeded", err)
+	}
+
+	received := make(chan []byte)
+	go func() {
+		var data []byte
+		buf := make([]byte, 16)
+		for len(data) < 5 {
+			n, err := device.Read(buf)
+			if err != nil {
+				break
+			}
+			data = append(data, buf[:n]...)
+		}
+		received <- data
+	}()
+	conn.SetWriteDeadline(time.Now().Add(time.Second))
+	if n, err := conn.Write([]byte{4, 5}); err != nil || n != 2 {
+		t.Fatalf("error got %d %v, should write 2 bytes", n, err)
+	}
+	if data := <-received; string(data) != string([]byte{1, 2, 3, 4, 5}) {
+		t.Errorf("error got %v, should be [1 2 3 4 5]", data)
+	}
+}
+
+// Test if a connection queries a device over the serial dialer, with the device name stripped of the TCP port
+func TestDialerQuery(t *testing.T) {
+	host, device := loopback()
+	var opened string
+	dialer := Dialer(func(name string) (io.ReadWriteCloser, error) {
+		opened = name
+		return host, nil
+	})
+
+	go func() { // answers every request with a SoC of 50%
+		builder := rct.NewDatagramBuilder()
+		buf := make([]byte, 64)
+		for {
+			if _, err := device.Read(buf); err != nil {
+				return
+			}
+			builder.Build(&rct.Datagram{Cmd: rct.Response, Id: rct.BatterySoC, Data: []byte{0x3f, 0x00, 0x00, 0x00}})
+			if _, err := device.Write(builder.Bytes()); err != nil {
+				return
+			}
+		}
+	}()
+
+	conn, err := rct.NewConnection("/dev/ttyTEST", 0, rct.WithDialer(dialer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if opened != "/dev/ttyTEST" {
+		t.Errorf("error opened %q, should be /dev/ttyTEST", opened)
+	}
+	soc, err := conn.QueryFloat32(rct.BatterySoC)
+	if err != nil || soc != 0.5 {
+		t.Errorf("error got %v %v, should be 0.5", soc, err)
+	}
+}
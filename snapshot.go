@@ -0,0 +1,174 @@
+package rct
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Energy totals of the RCT device since installation, in kWh
+type EnergyTotals struct {
+	Total      float64 // total energy produced
+	SolarA     float64 // energy from solar generator A
+	SolarB     float64 // energy from solar generator B
+	BattIn     float64 // energy charged into the battery
+	BattOut    float64 // energy discharged from the battery
+	Household  float64 // energy consumed by the household
+	Grid       float64 // net energy exchanged with the grid
+	GridFeedIn float64 // energy fed into the grid
+	GridLoad   float64 // energy taken from the grid
+}
+
+// Queries all energy totals on the RCT device, converted from Wh into kWh
+func (c *Connection) QueryEnergyTotals() (e EnergyTotals, err error) {
+	err = c.queryFloat32s([]float32Field{
+		{TotalEnergyWh, &e.Total},
+		{TotalEnergySolarGenAWh, &e.SolarA},
+		{TotalEnergySolarGenBWh, &e.SolarB},
+		{TotalEnergyBattInWh, &e.BattIn},
+		{TotalEnergyBattOutWh, &e.BattOut},
+		{TotalEnergyHouseholdWh, &e.Household},
+		{TotalEnergyGridWh, &e.Grid},
+		{TotalEnergyGridFeedInWh, &e.GridFeedIn},
+		{TotalEnergyGridLoadWh, &e.GridLoad},
+	}, 0.001)
+	if err != nil {
+		return EnergyTotals{}, err
+	}
+	return e, nil
+}
+
+// Live power flows of the RCT device in W, and the battery state of charge
+type PowerSnapshot struct {
+	SolarA     float64 // power from solar generator A
+	SolarB     float64 // power from solar generator B
+	Battery    float64 // battery power, positive = discharge, negative = charge
+	InverterAC float64 // inverter AC power
+	Grid       float64 // grid power, positive = taken from grid, negative = feed into grid
+	BatterySoC float64 // battery state of charge, range 0 ... 1
+}
+
+// Queries the live power flows and battery state of charge on the RCT device
+func (c *Connection) QueryPowerSnapshot() (p PowerSnapshot, err error) {
+	err = c.queryFloat32s([]float32Field{
+		{SolarGenAPowerW, &p.SolarA},
+		{SolarGenBPowerW, &p.SolarB},
+		{BatteryPowerW, &p.Battery},
+		{InverterACPowerW, &p.InverterAC},
+		{TotalGridPowerW, &p.Grid},
+		{BatterySoC, &p.BatterySoC},
+	}, 1)
+	if err != nil {
+		return PowerSnapshot{}, err
+	}
+	return p, nil
+}
+
+// Identification of the RCT device
+type DeviceInfo struct {
+	Name            string // user-assigned device name
+	SerialNumber    string // inverter serial number
+	SoftwareVersion string // control software version
+}
+
+// Queries the identification of the RCT device. The rated power has no known identifier, so setters keep
+// validating against MaxPowerW, unless configured otherwise with WithMaxPowerW.
+func (c *Connection) Detect() (*DeviceInfo, error) {
+	var info DeviceInfo
+	fields := []struct {
+		id  Identifier
+		val *string
+	}{
+		{DeviceName, &info.Name},
+		{DeviceSerialNumber, &info.SerialNumber},
+		{DeviceSoftwareVersion, &info.SoftwareVersion},
+	}
+	for _, f := range fields {
+		dg, err := c.Query(f.id)
+		if err != nil {
+			return nil, fmt.Errorf("querying %s: %w", f.id, err)
+		}
+		*f.val = strings.TrimRight(string(dg.Data), "\x00")
+	}
+	return &info, nil
+}
+
+// Queries the battery power on the RCT device, split into non-negative charge and discharge power in W,
+// of which at most one is non-zero
+func (c *Connection) QueryBatteryFlow() (charge, discharge float32, err error) {
+	v, err := c.QueryFloat32(BatteryPowerW)
+	if err != nil {
+		return 0, 0, err
+	}
+	discharge, charge = splitSigned(v) // positive = discharge, negative = charge
+	return charge, discharge, nil
+}
+
+// Queries the power charged into the battery on the RCT device in W, or 0 while discharging
+func (c *Connection) QueryBatteryChargePowerW() (float32, error) {
+	charge, _, err := c.QueryBatteryFlow()
+	return charge, err
+}
+
+// Queries the power discharged from the battery on the RCT device in W, or 0 while charging
+func (c *Connection) QueryBatteryDischargePowerW() (float32, error) {
+	_, discharge, err := c.QueryBatteryFlow()
+	return discharge, err
+}
+
+// Queries the grid power on the RCT device, split into non-negative import and export power in W,
+// of which at most one is non-zero
+func (c *Connection) QueryGridFlow() (imported, exported float32, err error) {
+	v, err := c.QueryFloat32(TotalGridPowerW)
+	if err != nil {
+		return 0, 0, err
+	}
+	imported, exported = splitSigned(v) // positive = taken from grid, negative = feed into grid
+	return imported, exported, nil
+}
+
+// Queries the power taken from the grid on the RCT device in W, or 0 while feeding in
+func (c *Connection) QueryGridImportPowerW() (float32, error) {
+	imported, _, err := c.QueryGridFlow()
+	return imported, err
+}
+
+// Queries the power fed into the grid on the RCT device in W, or 0 while taking power from it
+func (c *Connection) QueryGridExportPowerW() (float32, error) {
+	_, exported, err := c.QueryGridFlow()
+	return exported, err
+}
+
+// Splits a signed value into its positive part and the magnitude of its negative part
+func splitSigned(v float32) (pos, neg float32) {
+	if v < 0 {
+		return 0, -v
+	}
+	return v, 0
+}
+
+// A float32 identifier and the destination for its value
+type float32Field struct {
+	id  Identifier
+	val *float64
+}
+
+// Queries the given float32 identifiers sequentially via QueryMultiple, storing their values multiplied by scale
+func (c *Connection) queryFloat32s(fields []float32Field, scale float64) error {
+	ids := make([]Identifier, len(fields))
+	for i, f := range fields {
+		ids[i] = f.id
+	}
+
+	dgs, err := c.QueryMultiple(ids...)
+	if err != nil {
+		return err
+	}
+	for i, f := range fields {
+		v, err := dgs[i].Float32()
+		if err != nil {
+			return err
+		}
+		*f.val = float64(v) * scale
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package rct
+
+import (
+	"testing"
+	"time"
+)
+
+// Test if energy totals are queried and converted into kWh
+func TestQueryEnergyTotals(t *testing.T) {
+	values := map[Identifier]float32{
+		TotalEnergyWh:           10000,
+		TotalEnergySolarGenAWh:  6000,
+		TotalEnergySolarGenBWh:  4000,
+		TotalEnergyBattInWh:     2500,
+		TotalEnergyBattOutWh:    2000,
+		TotalEnergyHouseholdWh:  7000,
+		TotalEnergyGridWh:       -1500,
+		TotalEnergyGridFeedInWh: 3500,
+		TotalEnergyGridLoadWh:   2000,
+	}
+	srv := newMockServer(t, func(req *Datagram) *Datagram {
+		return &Datagram{Response, req.Id, EncodeFloat32(values[req.Id])}
+	})
+	conn, err := NewConnection(srv.Addr(), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	e, err := conn.QueryEnergyTotals()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := EnergyTotals{10, 6, 4, 2.5, 2, 7, -1.5, 3.5, 2}
+	if e != expect {
+		t.Errorf("error got %+v, should be %+v", e, expect)
+	}
+}
+
+// Test if the power snapshot is queried with sign conventions intact, including a charging battery
+func TestQueryPowerSnapshot(t *testing.T) {
+	values := map[Identifier]float32{
+		SolarGenAPowerW:  3200,
+		SolarGenBPowerW:  1800,
+		BatteryPowerW:    -2500, // charging
+		InverterACPowerW: 2400,
+		TotalGridPowerW:  -400, // feed in
+		BatterySoC:       0.75,
+	}
+	srv := newMockServer(t, func(req *Datagram) *Datagram {
+		return &Datagram{Response, req.Id, EncodeFloat32(values[req.Id])}
+	})
+	conn, err := NewConnection(srv.Addr(), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	p, err := conn.QueryPowerSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := PowerSnapshot{3200, 1800, -2500, 2400, -400, 0.75}
+	if p != expect {
+		t.Errorf("error got %+v, should be %+v", p, expect)
+	}
+}
+
+// Test if battery and grid flows are split into non-negative directions according to their sign conventions
+func TestQueryFlows(t *testing.T) {
+	regs := &mockRegisters{values: map[Identifier][]byte{
+		BatteryPowerW:   EncodeFloat32(-1200), // charging
+		TotalGridPowerW: EncodeFloat32(300),   // importing
+	}}
+	srv := newMockServer(t, regs.handle)
+	conn, err := NewConnection(srv.Addr(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if charge, discharge, err := conn.QueryBatteryFlow(); err != nil || charge != 1200 || discharge != 0 {
+		t.Errorf("error got charge %f discharge %f %v, should be 1200 and 0", charge, discharge, err)
+	}
+	if imported, exported, err := conn.QueryGridFlow(); err != nil || imported != 300 || exported != 0 {
+		t.Errorf("error got import %f export %f %v, should be 300 and 0", imported, exported, err)
+	}
+
+	regs.mu.Lock()
+	regs.values[BatteryPowerW] = EncodeFloat32(800)     // discharging
+	regs.values[TotalGridPowerW] = EncodeFloat32(-2500) // feeding in
+	regs.mu.Unlock()
+
+	if v, err := conn.QueryBatteryChargePowerW(); err != nil || v != 0 {
+		t.Errorf("error got charge %f %v, should be 0", v, err)
+	}
+	if v, err := conn.QueryBatteryDischargePowerW(); err != nil || v != 800 {
+		t.Errorf("error got discharge %f %v, should be 800", v, err)
+	}
+	if v, err := conn.QueryGridImportPowerW(); err != nil || v != 0 {
+		t.Errorf("error got import %f %v, should be 0", v, err)
+	}
+	if v, err := conn.QueryGridExportPowerW(); err != nil || v != 2500 {
+		t.Errorf("error got export %f %v, should be 2500", v, err)
+	}
+}
+
+// Test if device identification is queried with NUL padding removed, and failures name the identifier
+func TestDetect(t *testing.T) {
+	name, _ := EncodeString("Garage", 16)
+	regs := &mockRegisters{values: map[Identifier][]byte{
+		DeviceName:            name,
+		DeviceSerialNumber:    []byte("0123456789"),
+		DeviceSoftwareVersion: []byte("3.42\x00\x00"),
+	}}
+	srv := newMockServer(t, regs.handle)
+	conn, err := NewConnection(srv.Addr(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	info, err := conn.Detect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := DeviceInfo{"Garage", "0123456789", "3.42"}
+	if *info != expect {
+		t.Errorf("error got %+v, should be %+v", *info, expect)
+	}
+}
@@ -0,0 +1,35 @@
+package rct
+
+import (
+	"sync/atomic"
+)
+
+// Connection health metrics, as a snapshot returned by Connection.Stats
+type Stats struct {
+	Received      uint64 // Number of datagrams received and parsed successfully
+	ParseErrors   uint64 // Number of transmissions which could not be parsed into a datagram
+	CRCErrors     uint64 // Number of frames discarded due to a CRC mismatch
+	Queries       uint64 // Number of queries issued
+	QueryTimeouts uint64 // Number of queries which timed out waiting for a response
+	CacheHits     uint64 // Number of queries answered from the cache
+	CacheMisses   uint64 // Number of queries which required a network round-trip
+	Reconnects    uint64 // Number of times the connection to the device was re-established
+	Retries       uint64 // Number of sends repeated after a failure
+	BytesReceived uint64 // Number of raw bytes received, including framing and discarded bytes
+}
+
+// Returns a snapshot of the connection health metrics
+func (c *Connection) Stats() Stats {
+	return Stats{
+		Received:      atomic.LoadUint64(&c.stats.Received),
+		ParseErrors:   atomic.LoadUint64(&c.stats.ParseErrors),
+		CRCErrors:     atomic.LoadUint64(&c.stats.CRCErrors),
+		Queries:       atomic.LoadUint64(&c.stats.Queries),
+		QueryTimeouts: atomic.LoadUint64(&c.stats.QueryTimeouts),
+		CacheHits:     atomic.LoadUint64(&c.stats.CacheHits),
+		CacheMisses:   atomic.LoadUint64(&c.stats.CacheMisses),
+		Reconnects:    atomic.LoadUint64(&c.stats.Reconnects),
+		Retries:       atomic.LoadUint64(&c.stats.Retries),
+		BytesReceived: atomic.LoadUint64(&c.stats.BytesReceived),
+	}
+}
@@ -0,0 +1,46 @@
+package rct
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Test if queries, cache hits, retries and received bytes are counted
+func TestStats(t *testing.T) {
+	srv := newMockServer(t, respondWith(EncodeFloat32(0.5)))
+	var dials int32
+	dialer := func(ctx context.Context, address string) (net.Conn, error) {
+		if atomic.AddInt32(&dials, 1) == 1 {
+			client, server := net.Pipe()
+			server.Close() // first transport is dead, forcing a retry
+			return client, nil
+		}
+		var d net.Dialer
+		return d.DialContext(ctx, "tcp", srv.Addr())
+	}
+	conn, err := NewConnection("inverter", time.Minute, WithDialer(dialer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	for _, id := range []Identifier{BatterySoC, BatterySoC, BatteryPowerW} {
+		if _, err := conn.Query(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	builder := NewDatagramBuilder()
+	builder.Build(&Datagram{Response, BatterySoC, EncodeFloat32(0.5)})
+	frameSoC := len(builder.Bytes())
+	builder.Build(&Datagram{Response, BatteryPowerW, EncodeFloat32(0.5)})
+	framePower := len(builder.Bytes())
+
+	expect := Stats{Received: 2, Queries: 3, CacheHits: 1, CacheMisses: 2, Reconnects: 1, Retries: 1, BytesReceived: uint64(frameSoC + framePower)}
+	if s := conn.Stats(); s != expect {
+		t.Errorf("error got %+v, should be %+v", s, expect)
+	}
+}
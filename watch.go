@@ -0,0 +1,83 @@
+package rct
+
+import (
+	"bytes"
+	"math"
+	"sync"
+)
+
+// A watcher of changes to the value of an identifier
+type watcher struct {
+	id   Identifier
+	ch   chan *Datagram
+	last *Datagram // last datagram delivered, or nil if none yet
+
+	changed func(last, dg *Datagram) bool // reports whether a datagram is delivered, given the last one or nil
+}
+
+// Returns a channel delivering datagrams for the given identifier whenever its value changes, and a function to
+// cancel the watch and close the channel. Values are observed as they are received by queries on this connection,
+// so the caller needs to query the identifier periodically. Changes are skipped while the channel is full.
+func (c *Connection) Watch(id Identifier) (<-chan *Datagram, func()) {
+	return c.watch(id, func(last, dg *Datagram) bool {
+		return last == nil || !bytes.Equal(last.Data, dg.Data)
+	})
+}
+
+// Like Watch, but only delivers float32 values differing from the last delivered value by at least the given delta,
+// suppressing jitter e.g. of power values hovering around a threshold. Datagrams not holding a float32 are skipped.
+func (c *Connection) WatchWithThreshold(id Identifier, minDelta float32) (<-chan *Datagram, func()) {
+	return c.watch(id, func(last, dg *Datagram) bool {
+		v, err := dg.Float32()
+		if err != nil {
+			return false
+		}
+		if last == nil {
+			return true
+		}
+		prev, err := last.Float32()
+		if err != nil {
+			return true
+		}
+		return float32(math.Abs(float64(v-prev))) >= minDelta
+	})
+}
+
+// Registers a watcher for the given identifier, delivering datagrams for which the given function reports a change
+func (c *Connection) watch(id Identifier, changed func(last, dg *Datagram) bool) (<-chan *Datagram, func()) {
+	w := &watcher{id: id, ch: make(chan *Datagram, 1), changed: changed}
+
+	c.watchMu.Lock()
+	if c.watchers == nil {
+		c.watchers = make(map[*watcher]struct{})
+	}
+	c.watchers[w] = struct{}{}
+	c.watchMu.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			c.watchMu.Lock()
+			delete(c.watchers, w)
+			c.watchMu.Unlock()
+			close(w.ch)
+		})
+	}
+	return w.ch, cancel
+}
+
+// Delivers the given received datagram to all watchers of its identifier for which its value changed
+func (c *Connection) notifyWatchers(dg *Datagram) {
+	c.watchMu.Lock()
+	defer c.watchMu.Unlock()
+	for w := range c.watchers {
+		if w.id != dg.Id || !w.changed(w.last, dg) {
+			continue
+		}
+		select {
+		case w.ch <- dg:
+			w.last = dg
+		default: // consumer is busy, deliver on a later change
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package rct
+
+import (
+	"testing"
+)
+
+// Test if repeated identical values produce a single delivery, and changes are delivered
+func TestWatch(t *testing.T) {
+	values := []float32{0.5, 0.5, 0.5, 0.6, 0.6}
+	i := 0
+	srv := newMockServer(t, func(req *Datagram) *Datagram {
+		v := values[i]
+		i++
+		return &Datagram{Response, req.Id, EncodeFloat32(v)}
+	})
+	conn, err := NewConnection(srv.Addr(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ch, cancel := conn.Watch(BatterySoC)
+	var got []float32
+	for range values {
+		if _, err := conn.Query(BatterySoC); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case dg := <-ch:
+			v, _ := dg.Float32()
+			got = append(got, v)
+		default:
+		}
+	}
+	if len(got) != 2 || got[0] != 0.5 || got[1] != 0.6 {
+		t.Errorf("error got deliveries %v, should be [0.5 0.6]", got)
+	}
+
+	cancel()
+	if _, ok := <-ch; ok {
+		t.Errorf("error channel not closed after cancel")
+	}
+	cancel() // cancelling twice is harmless
+}
+
+// Test if values within the threshold of the last delivery are suppressed, and values crossing it are delivered
+func TestWatchWithThreshold(t *testing.T) {
+	values := []float32{100, 104, 96, 105, 108, 115, 110}
+	i := 0
+	srv := newMockServer(t, func(req *Datagram) *Datagram {
+		v := values[i]
+		i++
+		return &Datagram{Response, req.Id, EncodeFloat32(v)}
+	})
+	conn, err := NewConnection(srv.Addr(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ch, cancel := conn.WatchWithThreshold(BatteryPowerW, 5)
+	defer cancel()
+	var got []float32
+	for range values {
+		if _, err := conn.Query(BatteryPowerW); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case dg := <-ch:
+			v, _ := dg.Float32()
+			got = append(got, v)
+		default:
+		}
+	}
+	want := []float32{100, 105, 115, 110}
+	if len(got) != len(want) {
+		t.Fatalf("error got deliveries %v, should be %v", got, want)
+	}
+	for j := range want {
+		if got[j] != want[j] {
+			t.Errorf("error got deliveries %v, should be %v", got, want)
+			break
+		}
+	}
+}
+
+// Test if a threshold watch on an identifier not holding a float32 delivers nothing, not even the first value
+func TestWatchWithThresholdNonFloat(t *testing.T) {
+	srv := newMockServer(t, respondWith(EncodeUint8(uint8(StateFeedIn))))
+	conn, err := NewConnection(srv.Addr(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ch, cancel := conn.WatchWithThreshold(InverterState, 1)
+	defer cancel()
+	for i := 0; i < 2; i++ {
+		if _, err := conn.Query(InverterState); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case dg := <-ch:
+		t.Errorf("error got delivery %v for uint8 identifier", dg)
+	default:
+	}
+}
@@ -0,0 +1,308 @@
+package rct
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// MaxPowerW is the default maximum power in W accepted by setters. It is a conservative limit rather than the rating
+// of any particular inverter, which cannot be queried; see WithMaxPowerW to adjust it.
+const MaxPowerW = 6000
+
+// Error caused by a value outside the valid range for a write, which is rejected before sending
+type ValidationError struct {
+	Err string
+}
+
+// Prints error to string
+func (e ValidationError) Error() string {
+	return e.Err
+}
+
+// Writes the given raw value to the given identifier on the RCT device
+func (c *Connection) Write(id Identifier, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	builder := c.getBuilder()
+	defer c.putBuilder(builder)
+	req := &Datagram{Write, id, data}
+	if err := builder.BuildChecked(req); err != nil {
+		return err
+	}
+	c.cache.Delete(id) // cached value is outdated once written
+	_, err := c.send(builder, req)
+	return err
+}
+
+// Writes the given raw value to the given identifier on the RCT device as a LongWrite datagram, for payloads
+// exceeding MaxDataLength such as schedule tables
+func (c *Connection) WriteLong(id Identifier, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	builder := c.getBuilder()
+	defer c.putBuilder(builder)
+	req := &Datagram{LongWrite, id, data}
+	if err := builder.BuildChecked(req); err != nil {
+		return err
+	}
+	c.cache.Delete(id) // cached value is outdated once written
+	_, err := c.send(builder, req)
+	return err
+}
+
+// Writes the given raw value to the given identifier on the RCT device, and waits up to WriteAckTimeout for the
+// device to acknowledge it with a response for the same identifier, which is returned. Firmware versions differ in
+// whether they acknowledge writes; if no acknowledgement arrives, ErrNoWriteAck is returned.
+func (c *Connection) WriteAcked(id Identifier, data []byte) (*Datagram, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	builder := c.getBuilder()
+	defer c.putBuilder(builder)
+	req := &Datagram{Write, id, data}
+	if err := builder.BuildChecked(req); err != nil {
+		return nil, err
+	}
+	c.cache.Delete(id) // cached value is outdated once written
+	if _, err := c.send(builder, req); err != nil {
+		return nil, err
+	}
+	dg, err := c.receive(id, WriteAckTimeout)
+	if errors.Is(err, ErrTimeout) {
+		return nil, fmt.Errorf("%w for %08X: %v", ErrNoWriteAck, uint32(id), err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if (dg.Cmd != Response && dg.Cmd != LongResponse) || dg.Id != id {
+		return nil, RecoverableError{fmt.Sprintf("invalid acknowledgement of write to %08X: %v", uint32(id), dg)}
+	}
+	return dg, nil
+}
+
+// Writes the given float32 value to the given identifier on the RCT device
+func (c *Connection) WriteFloat32(id Identifier, v float32) error {
+	return c.Write(id, EncodeFloat32(v))
+}
+
+// Writes the given uint16 value to the given identifier on the RCT device
+func (c *Connection) WriteUint16(id Identifier, v uint16) error {
+	return c.Write(id, EncodeUint16(v))
+}
+
+// Writes the given uint8 value to the given identifier on the RCT device
+func (c *Connection) WriteUint8(id Identifier, v uint8) error {
+	return c.Write(id, EncodeUint8(v))
+}
+
+// Writes the given bool value to the given identifier on the RCT device
+func (c *Connection) WriteBool(id Identifier, v bool) error {
+	return c.Write(id, EncodeBool(v))
+}
+
+// Writes the given ASCII string to the given identifier on the RCT device, padded with NUL bytes to the given length
+func (c *Connection) WriteString(id Identifier, s string, length int) error {
+	data, err := EncodeString(s, length)
+	if err != nil {
+		return err
+	}
+	return c.Write(id, data)
+}
+
+// Sets the battery state of charge strategy
+func (c *Connection) SetSocStrategy(s SocStrategy) error {
+	if s > SOCTargetSchedule {
+		return ValidationError{fmt.Sprintf("invalid SoC strategy %d", uint8(s))}
+	}
+	return c.WriteUint8(PowerMngSocStrategy, uint8(s))
+}
+
+// Sets the battery state of charge strategy from its raw value, for callers holding an untyped value, e.g. from
+// configuration. Prefer SetSocStrategy with the SOCTarget constants.
+func (c *Connection) SetSocStrategyUint8(v uint8) error {
+	return c.SetSocStrategy(SocStrategy(v))
+}
+
+// Sets the battery charge power in W used by the SOCTargetSOC strategy, in range 0 ... MaxPowerW or as configured
+// with WithMaxPowerW
+func (c *Connection) SetSocChargePower(power uint16) error {
+	if power > c.maxPowerW {
+		return ValidationError{fmt.Sprintf("invalid SoC charge power %dW, must be in range 0 ... %dW", power, c.maxPowerW)}
+	}
+	if err := c.WriteFloat32(PowerMngSocChargePowerW, float32(power)); err != nil {
+		return fmt.Errorf("writing %s: %w", PowerMngSocChargePowerW, err)
+	}
+	return nil
+}
+
+// Enables or disables charging the battery from the grid
+func (c *Connection) SetUseGridPower(enable bool) error {
+	return c.WriteBool(PowerMngUseGridPowerEnable, enable)
+}
+
+// Forces charging the battery to the given state of charge in range 0 ... 1, with the given power in W, drawing
+// from the grid if needed. Writes charge power, target, grid usage and finally the SOCTargetSOC strategy, verifying
+// each write. If any step fails, all previous values are restored, see WriteTransaction.
+func (c *Connection) ForceCharge(targetSoC float32, powerW uint16) error {
+	if !(targetSoC >= 0 && targetSoC <= 1) {
+		return ValidationError{fmt.Sprintf("invalid target SoC %v, must be in range 0 ... 1", targetSoC)}
+	}
+	if powerW > c.maxPowerW {
+		return ValidationError{fmt.Sprintf("invalid charge power %dW, must be in range 0 ... %dW", powerW, c.maxPowerW)}
+	}
+	targetSoC = float32(math.Round(float64(targetSoC)*100) / 100)
+	return c.WriteTransaction([]WriteOp{
+		{PowerMngSocChargePowerW, EncodeFloat32(float32(powerW))},
+		{PowerMngSocTargetSet, EncodeFloat32(targetSoC)},
+		{PowerMngUseGridPowerEnable, EncodeBool(true)},
+		{PowerMngSocStrategy, EncodeUint8(uint8(SOCTargetSOC))},
+	})
+}
+
+// Ends forced charging by returning control to the inverter with the SOCTargetInternal strategy. Charging from the
+// grid stays enabled, as its value before ForceCharge is unknown here; disable it with SetUseGridPower if needed.
+func (c *Connection) ClearForceCharge() error {
+	return c.SetSocStrategy(SOCTargetInternal)
+}
+
+// Sets the minimum battery state of charge reserved for island (backup power) operation, in range 0 ... 1.
+// The value is rounded to two decimals, as the device does not resolve finer steps.
+func (c *Connection) SetSocMinIsland(min float32) error {
+	return c.writeSoc(BatterySoCTargetMinIsland, min)
+}
+
+// Writes a state of charge value in range 0 ... 1 to the given identifier, rounded to two decimals
+func (c *Connection) writeSoc(id Identifier, soc float32) error {
+	if !(soc >= 0 && soc <= 1) {
+		return ValidationError{fmt.Sprintf("invalid %s %v, must be in range 0 ... 1", id, soc)}
+	}
+	soc = float32(math.Round(float64(soc)*100) / 100)
+	if err := c.WriteFloat32(id, soc); err != nil {
+		return fmt.Errorf("writing %s: %w", id, err)
+	}
+	return nil
+}
+
+// Writes the given raw value and reads it back, returning an error if the device does not reflect the written value.
+// Values of float32 identifiers match within the tolerance of WriteAndWait, as the device may round them.
+func (c *Connection) writeVerified(id Identifier, data []byte) error {
+	if err := c.Write(id, data); err != nil {
+		return err
+	}
+	dg, err := c.QueryFresh(id)
+	if err != nil {
+		return err
+	}
+	if !settled(id, dg.Data, data) {
+		return RecoverableError{fmt.Sprintf("write of %08X not applied, wrote %v, read back %v", uint32(id), data, dg.Data)}
+	}
+	return nil
+}
+
+// Tolerance within which float32 values read back by WriteAndWait match the written value
+const settleEpsilon = 1e-3
+
+// Writes the given raw value, then reads it back until the device reflects it or the settle timeout elapses, for
+// devices which take a while to apply a change. Reads back after 100ms, doubling the delay up to 1s between reads.
+// Values of float32 identifiers match within 0.001. On timeout, returns the last mismatch or read error.
+func (c *Connection) WriteAndWait(id Identifier, data []byte, settleTimeout time.Duration) error {
+	if err := c.Write(id, data); err != nil {
+		return err
+	}
+	deadline := c.clock.Now().Add(settleTimeout)
+	delay := 100 * time.Millisecond
+	for {
+		dg, err := c.QueryFresh(id)
+		if err == nil {
+			if settled(id, dg.Data, data) {
+				return nil
+			}
+			err = RecoverableError{fmt.Sprintf("write of %08X not applied within %v, wrote %v, read back %v", uint32(id), settleTimeout, data, dg.Data)}
+		}
+		if !c.clock.Now().Add(delay).Before(deadline) {
+			return err
+		}
+		<-c.clock.After(delay)
+		if delay *= 2; delay > time.Second {
+			delay = time.Second
+		}
+	}
+}
+
+// Returns true if the given value read back from the given identifier matches the written one
+func settled(id Identifier, read, written []byte) bool {
+	if bytes.Equal(read, written) {
+		return true
+	}
+	if reg, ok := LookupRegister(id); !ok || reg.Kind != KindFloat32 || len(read) != 4 || len(written) != 4 {
+		return false
+	}
+	r, _ := (&Datagram{Data: read}).Float32()
+	w, _ := (&Datagram{Data: written}).Float32()
+	return math.Abs(float64(r)-float64(w)) <= settleEpsilon
+}
+
+// A single write operation within a transaction
+type WriteOp struct {
+	Id   Identifier
+	Data []byte
+}
+
+// Error returned when a write transaction fails, describing the failed operation and the outcome of the rollback
+type WriteTransactionError struct {
+	Index       int // index of the failed operation, or -1 if reading the previous values failed
+	Op          WriteOp
+	Err         error // cause of the failure
+	RollbackErr error // cause of the rollback failure, or nil if rollback succeeded
+}
+
+// Prints error to string
+func (e *WriteTransactionError) Error() string {
+	if e.Index < 0 {
+		return fmt.Sprintf("reading previous value of %08X failed: %v", uint32(e.Op.Id), e.Err)
+	}
+	if e.RollbackErr != nil {
+		return fmt.Sprintf("write %d of %08X failed: %v; rollback failed: %v", e.Index, uint32(e.Op.Id), e.Err, e.RollbackErr)
+	}
+	return fmt.Sprintf("write %d of %08X failed: %v; rolled back", e.Index, uint32(e.Op.Id), e.Err)
+}
+
+// Returns the cause of the failure
+func (e *WriteTransactionError) Unwrap() error {
+	return e.Err
+}
+
+// Applies the given writes in order, verifying each by reading it back. Reads the previous values first,
+// and on any failure attempts to restore them for all operations applied so far, in reverse order.
+func (c *Connection) WriteTransaction(ops []WriteOp) error {
+	prev := make([][]byte, len(ops))
+	for i, op := range ops {
+		dg, err := c.QueryFresh(op.Id)
+		if err != nil {
+			return &WriteTransactionError{Index: -1, Op: op, Err: err}
+		}
+		prev[i] = dg.Data
+	}
+
+	for i, op := range ops {
+		if err := c.writeVerified(op.Id, op.Data); err != nil {
+			return &WriteTransactionError{Index: i, Op: op, Err: err, RollbackErr: c.rollback(ops[:i+1], prev)}
+		}
+	}
+	return nil
+}
+
+// Restores the given previous values for the given operations in reverse order, returning the first error
+func (c *Connection) rollback(ops []WriteOp, prev [][]byte) (err error) {
+	for i := len(ops) - 1; i >= 0; i-- {
+		if e := c.writeVerified(ops[i].Id, prev[i]); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
@@ -0,0 +1,435 @@
+package rct
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Test if a write transaction failing mid-sequence rolls back the writes applied so far
+func TestWriteTransactionRollback(t *testing.T) {
+	regs := &mockRegisters{
+		values: map[Identifier][]byte{
+			BatterySoCTarget:     EncodeFloat32(0.5),
+			BatterySoCTargetHigh: EncodeFloat32(0.75),
+			BatterySoCTargetMin:  EncodeFloat32(0.25),
+		},
+		ignore: map[Identifier]bool{BatterySoCTargetHigh: true},
+	}
+	srv := newMockServer(t, regs.handle)
+	conn, err := NewConnection(srv.Addr(), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	err = conn.WriteTransaction([]WriteOp{
+		{BatterySoCTarget, EncodeFloat32(0.8)},
+		{BatterySoCTargetHigh, EncodeFloat32(0.9)},
+		{BatterySoCTargetMin, EncodeFloat32(0.1)},
+	})
+	var wtErr *WriteTransactionError
+	if !errors.As(err, &wtErr) {
+		t.Fatalf("error got %v, should be a WriteTransactionError", err)
+	}
+	if wtErr.Index != 1 || wtErr.Op.Id != BatterySoCTargetHigh || wtErr.RollbackErr != nil {
+		t.Errorf("error got index %d id %08X rollback error %v, should be index 1 id %08X no rollback error", wtErr.Index, uint32(wtErr.Op.Id), wtErr.RollbackErr, uint32(BatterySoCTargetHigh))
+	}
+
+	for id, expect := range map[Identifier][]byte{
+		BatterySoCTarget:     EncodeFloat32(0.5),
+		BatterySoCTargetHigh: EncodeFloat32(0.75),
+		BatterySoCTargetMin:  EncodeFloat32(0.25),
+	} {
+		if got := regs.get(id); !bytes.Equal(got, expect) {
+			t.Errorf("error %s got %v, should be restored to %v", id, got, expect)
+		}
+	}
+}
+
+// Test if a successful write transaction applies all writes
+func TestWriteTransaction(t *testing.T) {
+	regs := &mockRegisters{values: map[Identifier][]byte{
+		BatterySoCTarget:    EncodeFloat32(0.5),
+		BatterySoCTargetMin: EncodeFloat32(0.25),
+	}}
+	srv := newMockServer(t, regs.handle)
+	conn, err := NewConnection(srv.Addr(), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ops := []WriteOp{
+		{BatterySoCTarget, EncodeFloat32(0.8)},
+		{BatterySoCTargetMin, EncodeFloat32(0.1)},
+	}
+	if err := conn.WriteTransaction(ops); err != nil {
+		t.Fatal(err)
+	}
+	for _, op := range ops {
+		if got := regs.get(op.Id); !bytes.Equal(got, op.Data) {
+			t.Errorf("error %s got %v, should be %v", op.Id, got, op.Data)
+		}
+	}
+}
+
+// Test if typed writes encode their values
+func TestWriteTyped(t *testing.T) {
+	regs := &mockRegisters{values: map[Identifier][]byte{}}
+	srv := newMockServer(t, regs.handle)
+	conn, err := NewConnection(srv.Addr(), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err := conn.WriteFloat32(BatterySoCTarget, 0.5); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.WriteUint8(InverterState, 3); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := conn.QueryFloat32(BatterySoCTarget); err != nil || v != 0.5 {
+		t.Errorf("error got %f %v, should be 0.5", v, err)
+	}
+	if v, err := conn.QueryUint8(InverterState); err != nil || v != 3 {
+		t.Errorf("error got %d %v, should be 3", v, err)
+	}
+}
+
+// Test if the SoC strategy round-trips as a typed value, and invalid values are rejected
+func TestSocStrategy(t *testing.T) {
+	regs := &mockRegisters{values: map[Identifier][]byte{PowerMngSocStrategy: {byte(SOCTargetInternal)}}}
+	srv := newMockServer(t, regs.handle)
+	conn, err := NewConnection(srv.Addr(), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if s, err := conn.QuerySocStrategy(); err != nil || s != SOCTargetInternal {
+		t.Errorf("error got %v %v, should be %v", s, err, SOCTargetInternal)
+	}
+	if err := conn.SetSocStrategy(SOCTargetExternal); err != nil {
+		t.Fatal(err)
+	}
+	if s, err := conn.QuerySocStrategy(); err != nil || s != SOCTargetExternal {
+		t.Errorf("error got %v %v, should be %v", s, err, SOCTargetExternal)
+	}
+	for s := SOCTargetSOC; s <= SOCTargetSchedule; s++ {
+		if err := conn.SetSocStrategyUint8(uint8(s)); err != nil {
+			t.Errorf("error strategy %v rejected: %v", s, err)
+		}
+		if v, err := conn.QuerySocStrategy(); err != nil || v != s {
+			t.Errorf("error got %v %v, should be %v", v, err, s)
+		}
+	}
+	for _, v := range []uint8{6, 7, 255} {
+		if err := conn.SetSocStrategy(SocStrategy(v)); err == nil {
+			t.Errorf("error invalid strategy %d accepted", v)
+		}
+		if err := conn.SetSocStrategyUint8(v); err == nil {
+			t.Errorf("error invalid raw strategy %d accepted", v)
+		}
+	}
+
+	regs.mu.Lock()
+	regs.values[PowerMngSocStrategy] = []byte{7}
+	regs.mu.Unlock()
+	conn.cache.Delete(PowerMngSocStrategy)
+	if s, err := conn.QuerySocStrategy(); err == nil {
+		t.Errorf("error unknown strategy %d accepted", uint8(s))
+	}
+}
+
+// Test if the island minimum SoC is validated, rounded and written
+func TestSetSocMinIsland(t *testing.T) {
+	regs := &mockRegisters{values: map[Identifier][]byte{}}
+	srv := newMockServer(t, regs.handle)
+	conn, err := NewConnection(srv.Addr(), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err := conn.SetSocMinIsland(0.123); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := conn.QueryFloat32(BatterySoCTargetMinIsland); err != nil || v != 0.12 {
+		t.Errorf("error got %f %v, should be 0.12", v, err)
+	}
+	for _, v := range []float32{-0.01, 1.01, float32(math.NaN())} {
+		if err := conn.SetSocMinIsland(v); err == nil {
+			t.Errorf("error %f accepted", v)
+		}
+	}
+}
+
+// Test if the SoC charge power is validated against the hard cap and written as float32
+func TestSetSocChargePower(t *testing.T) {
+	regs := &mockRegisters{values: map[Identifier][]byte{}}
+	srv := newMockServer(t, regs.handle)
+	conn, err := NewConnection(srv.Addr(), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err := conn.SetSocChargePower(MaxPowerW); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := conn.QueryFloat32(PowerMngSocChargePowerW); err != nil || v != MaxPowerW {
+		t.Errorf("error got %f %v, should be %d", v, err, MaxPowerW)
+	}
+	err = conn.SetSocChargePower(MaxPowerW + 1)
+	if _, ok := err.(ValidationError); !ok {
+		t.Errorf("error got %v, should be ValidationError", err)
+	}
+
+	limited := newConnection(srv.Addr(), time.Minute, WithMaxPowerW(3000))
+	defer limited.Close()
+	if _, ok := limited.SetSocChargePower(3001).(ValidationError); !ok {
+		t.Errorf("error power above configured limit accepted")
+	}
+	if err := limited.SetSocChargePower(3000); err != nil {
+		t.Errorf("error %v for power at configured limit", err)
+	}
+}
+
+// Test if forced charging writes the documented sequence, rolls back on failure, and can be cleared
+func TestForceCharge(t *testing.T) {
+	initial := map[Identifier][]byte{
+		PowerMngSocStrategy:        EncodeUint8(uint8(SOCTargetInternal)),
+		PowerMngSocTargetSet:       EncodeFloat32(0.5),
+		PowerMngSocChargePowerW:    EncodeFloat32(0),
+		PowerMngUseGridPowerEnable: EncodeBool(false),
+	}
+	regs := &mockRegisters{values: map[Identifier][]byte{}, ignore: map[Identifier]bool{}}
+	for id, v := range initial {
+		regs.values[id] = v
+	}
+	srv := newMockServer(t, regs.handle)
+	conn, err := NewConnection(srv.Addr(), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, ok := conn.ForceCharge(1.5, 1000).(ValidationError); !ok {
+		t.Errorf("error invalid target accepted")
+	}
+	if _, ok := conn.ForceCharge(0.9, MaxPowerW+1).(ValidationError); !ok {
+		t.Errorf("error invalid power accepted")
+	}
+
+	// strategy write fails last, so all others need to be rolled back
+	regs.mu.Lock()
+	regs.ignore[PowerMngSocStrategy] = true
+	regs.mu.Unlock()
+	if err := conn.ForceCharge(0.9, 3000); err == nil {
+		t.Errorf("error failed force charge returned no error")
+	}
+	for id, v := range initial {
+		if got := regs.get(id); !bytes.Equal(got, v) {
+			t.Errorf("error %s got %v, should be restored to %v", id, got, v)
+		}
+	}
+
+	regs.mu.Lock()
+	regs.ignore[PowerMngSocStrategy] = false
+	regs.mu.Unlock()
+	if err := conn.ForceCharge(0.9, 3000); err != nil {
+		t.Fatal(err)
+	}
+	for id, v := range map[Identifier][]byte{
+		PowerMngSocStrategy:        EncodeUint8(uint8(SOCTargetSOC)),
+		PowerMngSocTargetSet:       EncodeFloat32(0.9),
+		PowerMngSocChargePowerW:    EncodeFloat32(3000),
+		PowerMngUseGridPowerEnable: EncodeBool(true),
+	} {
+		if got := regs.get(id); !bytes.Equal(got, v) {
+			t.Errorf("error %s got %v, should be %v", id, got, v)
+		}
+	}
+
+	if err := conn.ClearForceCharge(); err != nil {
+		t.Fatal(err)
+	}
+	if s, err := conn.QuerySocStrategy(); err != nil || s != SOCTargetInternal {
+		t.Errorf("error got %v %v, should be %v", s, err, SOCTargetInternal)
+	}
+}
+
+// Test if the use grid power flag round-trips through SetUseGridPower and QueryBool
+func TestUseGridPower(t *testing.T) {
+	regs := &mockRegisters{values: map[Identifier][]byte{PowerMngUseGridPowerEnable: {0}}}
+	srv := newMockServer(t, regs.handle)
+	conn, err := NewConnection(srv.Addr(), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	for _, enable := range []bool{true, false} {
+		if err := conn.SetUseGridPower(enable); err != nil {
+			t.Fatal(err)
+		}
+		if v, err := conn.QueryBool(PowerMngUseGridPowerEnable); err != nil || v != enable {
+			t.Errorf("error got %v %v, should be %v", v, err, enable)
+		}
+	}
+}
+
+// Test if acknowledged writes return the acknowledgement, or ErrNoWriteAck if the device sends none
+func TestWriteAcked(t *testing.T) {
+	defer func(d time.Duration) { WriteAckTimeout = d }(WriteAckTimeout)
+	WriteAckTimeout = 50 * time.Millisecond
+
+	for _, ack := range []bool{true, false} {
+		regs := &mockRegisters{values: map[Identifier][]byte{}}
+		srv := newMockServer(t, func(req *Datagram) *Datagram {
+			res := regs.handle(req)
+			if req.Cmd == Write && ack {
+				return &Datagram{Response, req.Id, req.Data} // echo the written value
+			}
+			return res
+		})
+		conn, err := NewConnection(srv.Addr(), time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dg, err := conn.WriteAcked(BatterySoCTarget, EncodeFloat32(0.8))
+		if ack && (err != nil || !bytes.Equal(dg.Data, EncodeFloat32(0.8))) {
+			t.Errorf("error got %v %v, should acknowledge 0.8", dg, err)
+		} else if !ack && !errors.Is(err, ErrNoWriteAck) {
+			t.Errorf("error got %v, should be %v", err, ErrNoWriteAck)
+		}
+		if v, err := conn.QueryFloat32(BatterySoCTarget); err != nil || v != 0.8 {
+			t.Errorf("error got %f %v, should be written 0.8", v, err)
+		}
+		conn.Close()
+	}
+}
+
+// Test if long writes deliver payloads beyond the single-byte length limit
+func TestWriteLong(t *testing.T) {
+	var got []byte
+	var mu sync.Mutex
+	srv := newMockServer(t, func(req *Datagram) *Datagram {
+		mu.Lock()
+		defer mu.Unlock()
+		if req.Cmd == LongWrite {
+			got = req.Data
+		}
+		return nil
+	})
+	conn, err := NewConnection(srv.Addr(), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	data := bytes.Repeat([]byte{0x2b, 0x01, 0x2d}, 100) // 300 bytes, with escaping
+	if err := conn.WriteLong(BatterySoCTarget, data); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		mu.Lock()
+		done := got != nil
+		mu.Unlock()
+		if done {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !bytes.Equal(got, data) {
+		t.Errorf("error device received %d bytes, should be %d", len(got), len(data))
+	}
+}
+
+// Test if WriteAndWait polls until a delayed write is applied, accepts float32 values within the tolerance,
+// and reports the mismatch once the settle timeout elapses
+func TestWriteAndWait(t *testing.T) {
+	var mu sync.Mutex
+	value, pending, reads := EncodeFloat32(0), []byte(nil), 0
+	applied := func(data []byte) []byte { return data }
+	srv := newMockServer(t, func(req *Datagram) *Datagram {
+		mu.Lock()
+		defer mu.Unlock()
+		switch req.Cmd {
+		case Write:
+			pending, reads = req.Data, 0
+		case Read:
+			if reads++; pending != nil && reads > 3 { // device applies the change after a while
+				value, pending = applied(pending), nil
+			}
+			return &Datagram{Response, req.Id, value}
+		}
+		return nil
+	})
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	conn, err := NewConnection(srv.Addr(), time.Minute, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err := conn.WriteAndWait(PowerMngSocChargePowerW, EncodeFloat32(1500), 5*time.Second); err != nil {
+		t.Errorf("error %v, delayed write should settle", err)
+	}
+
+	mu.Lock()
+	applied = func(data []byte) []byte { return EncodeFloat32(1000.0004) } // device rounds slightly
+	mu.Unlock()
+	if err := conn.WriteAndWait(PowerMngSocChargePowerW, EncodeFloat32(1000), 5*time.Second); err != nil {
+		t.Errorf("error %v, value within tolerance should settle", err)
+	}
+
+	mu.Lock()
+	applied = func(data []byte) []byte { return EncodeFloat32(42) } // device ignores the write
+	mu.Unlock()
+	start := clock.Now()
+	err = conn.WriteAndWait(PowerMngSocChargePowerW, EncodeFloat32(2000), 5*time.Second)
+	if !IsRecoverable(err) {
+		t.Errorf("error got %v, should be recoverable mismatch", err)
+	}
+	if d := clock.Now().Sub(start); d > 5*time.Second {
+		t.Errorf("error waited %v, beyond the settle timeout", d)
+	}
+}
+
+// Test if forced charging succeeds on a device which rounds the written target SoC slightly
+func TestForceChargeRounded(t *testing.T) {
+	regs := &mockRegisters{values: map[Identifier][]byte{
+		PowerMngSocStrategy:        EncodeUint8(uint8(SOCTargetInternal)),
+		PowerMngSocTargetSet:       EncodeFloat32(0.5),
+		PowerMngSocChargePowerW:    EncodeFloat32(0),
+		PowerMngUseGridPowerEnable: EncodeBool(false),
+	}}
+	srv := newMockServer(t, func(req *Datagram) *Datagram {
+		if req.Cmd == Write && req.Id == PowerMngSocTargetSet {
+			v, _ := req.Float32()
+			req = &Datagram{req.Cmd, req.Id, EncodeFloat32(v + 0.0004)}
+		}
+		return regs.handle(req)
+	})
+	conn, err := NewConnection(srv.Addr(), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err := conn.ForceCharge(0.9, 1000); err != nil {
+		t.Errorf("error %v, rounded target SoC should be accepted", err)
+	}
+	if s := regs.get(PowerMngSocStrategy); !bytes.Equal(s, EncodeUint8(uint8(SOCTargetSOC))) {
+		t.Errorf("error got strategy %v, should be %d", s, SOCTargetSOC)
+	}
+}